@@ -1,18 +1,55 @@
 package aws
 
 import (
+	"sync"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
 )
 
 type AWS struct {
-	key    string
-	secret string
-	region string
+	key        string
+	secret     string
+	region     string
+	roleARN    string
+	externalID string
+
+	mu   sync.Mutex
+	sess *session.Session
 }
 
-func (a *AWS) newConfig() *aws.Config {
-	return aws.NewConfig().WithCredentials(
-		credentials.NewStaticCredentials(a.key, a.secret, ""),
-	).WithRegion(a.region)
+// newSession uses the static key and secret when they are set, otherwise the
+// default credential chain of the SDK (environment, web identity token of
+// IRSA, shared config, container and instance profile). With roleARN those
+// credentials only assume the role.
+// The session is shared, so assumed role credentials are refreshed only when
+// they expire.
+func (a *AWS) newSession() (*session.Session, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.sess != nil {
+		return a.sess, nil
+	}
+
+	conf := aws.NewConfig().WithRegion(a.region)
+	if a.key != "" || a.secret != "" {
+		conf = conf.WithCredentials(credentials.NewStaticCredentials(a.key, a.secret, ""))
+	}
+	sess, err := session.NewSession(conf)
+	if err != nil {
+		return nil, err
+	}
+	if a.roleARN != "" {
+		sess = sess.Copy(aws.NewConfig().WithCredentials(
+			stscreds.NewCredentials(sess, a.roleARN, func(p *stscreds.AssumeRoleProvider) {
+				if a.externalID != "" {
+					p.ExternalID = aws.String(a.externalID)
+				}
+			}),
+		))
+	}
+	a.sess = sess
+	return sess, nil
 }
@@ -0,0 +1,34 @@
+package aws
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+func TestNewSession(t *testing.T) {
+	static := &AWS{key: "fakeKey", secret: "fakeSecret", region: "us-east-1"}
+	sess, err := static.newSession()
+	if err != nil {
+		t.Fatal("error creating session", err)
+	}
+	value, err := sess.Config.Credentials.Get()
+	if err != nil {
+		t.Fatal("error getting static credentials", err)
+	}
+	if value.ProviderName != credentials.StaticProviderName || value.AccessKeyID != "fakeKey" {
+		t.Errorf("expected static credentials, got %s from %s", value.AccessKeyID, value.ProviderName)
+	}
+	if cached, _ := static.newSession(); cached != sess {
+		t.Error("expected session to be shared")
+	}
+
+	role := &AWS{key: "fakeKey", secret: "fakeSecret", region: "us-east-1", roleARN: "arn:aws:iam::123456789012:role/mitose"}
+	sess, err = role.newSession()
+	if err != nil {
+		t.Fatal("error creating session", err)
+	}
+	if sess.Config.Credentials == static.sess.Config.Credentials {
+		t.Error("expected assumed role credentials")
+	}
+}
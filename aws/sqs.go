@@ -1,7 +1,8 @@
 package aws
 
 import (
-	"github.com/aws/aws-sdk-go/aws/session"
+	"context"
+
 	"github.com/aws/aws-sdk-go/service/sqs"
 )
 
@@ -9,8 +10,12 @@ type SQSClient struct {
 	*AWS
 }
 
-func (s *SQSClient) GetQueueAttributes(queueURL string, attributes ...string) (map[string]string, error) {
-	cli := sqs.New(session.New(), s.newConfig())
+func (s *SQSClient) GetQueueAttributes(ctx context.Context, queueURL string, attributes ...string) (map[string]string, error) {
+	sess, err := s.newSession()
+	if err != nil {
+		return nil, err
+	}
+	cli := sqs.New(sess)
 
 	var attrList []*string
 	for _, attr := range attributes {
@@ -18,7 +23,8 @@ func (s *SQSClient) GetQueueAttributes(queueURL string, attributes ...string) (m
 		attrList = append(attrList, &a)
 	}
 
-	out, err := cli.GetQueueAttributes(
+	out, err := cli.GetQueueAttributesWithContext(
+		ctx,
 		&sqs.GetQueueAttributesInput{QueueUrl: &queueURL, AttributeNames: attrList},
 	)
 
@@ -32,8 +38,10 @@ func (s *SQSClient) GetQueueAttributes(queueURL string, attributes ...string) (m
 	return result, nil
 }
 
-func NewSQSClient(key, secret, region string) *SQSClient {
+// NewSQSClient uses the default credential chain when key and secret are
+// empty, and assumes roleARN (with the optional externalID) when it is set.
+func NewSQSClient(key, secret, region, roleARN, externalID string) *SQSClient {
 	return &SQSClient{
-		AWS: &AWS{key: key, secret: secret, region: region},
+		AWS: &AWS{key: key, secret: secret, region: region, roleARN: roleARN, externalID: externalID},
 	}
 }
@@ -1,12 +1,64 @@
 package config
 
 type Config struct {
-	Namespace   string `json:"namespace"`
-	Deployment  string `json:"deployment"`
-	Type        string `json:"type"`
-	Max         int    `json:"max"`
-	Min         int    `json:"min"`
-	ScaleMethod string `json:"scale_method"`
-	Interval    string `json:"interval"`
-	Active      bool   `json:"active"`
+	Cluster          string `json:"cluster"`
+	Namespace        string `json:"namespace"`
+	Deployment       string `json:"deployment"`
+	TargetKind       string `json:"target_kind"`
+	TargetAPIVersion string `json:"target_api_version"`
+
+	Type        string  `json:"type"`
+	Max         int     `json:"max"`
+	Min         int     `json:"min"`
+	ScaleMethod string  `json:"scale_method"`
+	Interval    string  `json:"interval"`
+	Active      bool    `json:"active"`
+	Expression  string  `json:"expression"`
+	Timezone    string  `json:"timezone"`
+	MsgsPerPod  int     `json:"msgs_per_pod"`
+	Rounding    string  `json:"rounding"`
+	Tolerance   float64 `json:"tolerance"`
+
+	ActivationThreshold int    `json:"activation_threshold"`
+	IdlePeriod          string `json:"idle_period"`
+	InitialReplicas     int    `json:"initial_replicas"`
+
+	ScaleDownProbePort int    `json:"scale_down_probe_port"`
+	ScaleDownProbePath string `json:"scale_down_probe_path"`
+
+	Schedules []Schedule `json:"schedules"`
+}
+
+// Schedule overrides some fields of a Config while active, it becomes active
+// every time Cron fires and stays active for Duration.
+type Schedule struct {
+	Cron       string `json:"cron"`
+	Duration   string `json:"duration"`
+	Timezone   string `json:"timezone"`
+	Min        *int   `json:"min"`
+	Max        *int   `json:"max"`
+	MsgsPerPod *int   `json:"msgs_per_pod"`
+}
+
+// Apply returns a copy of c with the schedule overrides.
+func (s Schedule) Apply(c Config) Config {
+	if s.Min != nil {
+		c.Min = *s.Min
+	}
+	if s.Max != nil {
+		c.Max = *s.Max
+	}
+	if s.MsgsPerPod != nil {
+		c.MsgsPerPod = *s.MsgsPerPod
+	}
+	c.Schedules = nil
+	return c
+}
+
+// SecretRef points to the key of a Secret holding a credential, the
+// namespace defaults to the namespace of the deployment.
+type SecretRef struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Key       string `json:"key"`
 }
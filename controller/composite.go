@@ -0,0 +1,208 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/luizalabs/mitose/config"
+	"github.com/luizalabs/mitose/gauge"
+)
+
+const (
+	MaxAggregation = "max"
+	MinAggregation = "min"
+	AvgAggregation = "avg"
+	SumAggregation = "sum"
+)
+
+type CompositeControlerConfig struct {
+	config.Config
+	Aggregation string            `json:"aggregation"`
+	Colectors   []json.RawMessage `json:"collectors"`
+}
+
+type CompositeColector struct {
+	colectors []Colector
+}
+
+type CompositeCruncher struct {
+	crunchers   []Cruncher
+	aggregation string
+	max         int
+	min         int
+	gMetrics    gauge.Gauge
+}
+
+func (c *CompositeColector) GetMetrics(ctx context.Context) (Metrics, error) {
+	metrics := make(Metrics)
+	msgsInQueue := 0
+	for i, colector := range c.colectors {
+		m, err := colector.GetMetrics(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range m {
+			metrics[compositeMetricPrefix(i)+name] = value
+		}
+		n, err := strconv.Atoi(m[msgsInQueueMetricName])
+		if err != nil {
+			return nil, err
+		}
+		msgsInQueue += n
+	}
+	metrics[msgsInQueueMetricName] = strconv.Itoa(msgsInQueue)
+	return metrics, nil
+}
+
+func (c *CompositeCruncher) CalcDesiredReplicas(ctx context.Context, m Metrics) (int, error) {
+	recommendations := make([]int, len(c.crunchers))
+	for i, cruncher := range c.crunchers {
+		r, err := cruncher.CalcDesiredReplicas(ctx, colectorMetrics(m, i))
+		if err != nil {
+			return -1, err
+		}
+		recommendations[i] = r
+	}
+
+	desiredReplicas := aggregate(c.aggregation, recommendations)
+	if desiredReplicas > c.max {
+		desiredReplicas = c.max
+	} else if desiredReplicas < c.min {
+		desiredReplicas = c.min
+	}
+	c.gMetrics.Set(float64(desiredReplicas))
+	return desiredReplicas, nil
+}
+
+func aggregate(aggregation string, recommendations []int) int {
+	result := recommendations[0]
+	for _, r := range recommendations[1:] {
+		switch aggregation {
+		case MinAggregation:
+			if r < result {
+				result = r
+			}
+		case AvgAggregation, SumAggregation:
+			result += r
+		default:
+			if r > result {
+				result = r
+			}
+		}
+	}
+	if aggregation == AvgAggregation {
+		avg := float64(result) / float64(len(recommendations))
+		return int(math.Ceil(avg))
+	}
+	return result
+}
+
+func compositeMetricPrefix(index int) string {
+	return fmt.Sprintf("c%d_", index)
+}
+
+// compositeMetricSuffix tells apart the gauges of each collector, f.ex.
+// SQS_0 and CRUNCHER_0, from the ones of the composite.
+func compositeMetricSuffix(index int) string {
+	return fmt.Sprintf("_%d", index)
+}
+
+func colectorMetrics(m Metrics, index int) Metrics {
+	prefix := compositeMetricPrefix(index)
+	metrics := make(Metrics)
+	for name, value := range m {
+		if strings.HasPrefix(name, prefix) {
+			metrics[strings.TrimPrefix(name, prefix)] = value
+		}
+	}
+	return metrics
+}
+
+func NewCompositeColector(colectors ...Colector) Colector {
+	return &CompositeColector{colectors: colectors}
+}
+
+func NewCompositeCruncher(g gauge.Gauge, aggregation string, max, min int, crunchers ...Cruncher) (Cruncher, error) {
+	switch aggregation {
+	case "":
+		aggregation = MaxAggregation
+	case MaxAggregation, MinAggregation, AvgAggregation, SumAggregation:
+	default:
+		return nil, fmt.Errorf("invalid aggregation %q", aggregation)
+	}
+	return &CompositeCruncher{
+		crunchers:   crunchers,
+		aggregation: aggregation,
+		max:         max,
+		min:         min,
+		gMetrics:    g,
+	}, nil
+}
+
+// compositeCruncherFactory builds the aggregated cruncher, scale to zero is
+// applied once around it, so the collectors recommend at least one replica
+// while awake.
+func compositeCruncherFactory(aggregation string, colectors []json.RawMessage) cruncherBuilder {
+	return func(conf config.Config) (Cruncher, error) {
+		if conf.Expression != "" {
+			return newCruncher(conf)
+		}
+
+		crunchers := make([]Cruncher, len(colectors))
+		for i, raw := range colectors {
+			colectorConf := conf
+			if err := json.Unmarshal(raw, &colectorConf); err != nil {
+				return nil, err
+			}
+			var err error
+			if crunchers[i], err = buildCruncher(colectorConf, compositeMetricSuffix(i)); err != nil {
+				return nil, fmt.Errorf("collector %d: %v", i, err)
+			}
+		}
+
+		gCruncher := gauge.NewPrometheusGauge(conf.Namespace, conf.Deployment, "CRUNCHER")
+		return NewCompositeCruncher(gCruncher, aggregation, conf.Max, conf.Min, crunchers...)
+	}
+}
+
+func NewCompositeController(confJSON string) (*Controller, error) {
+	conf := new(CompositeControlerConfig)
+	if err := json.Unmarshal([]byte(confJSON), conf); err != nil {
+		return nil, err
+	}
+	if len(conf.Colectors) == 0 {
+		return nil, errors.New("composite controller without collectors")
+	}
+
+	// the composite expression and schedules apply to the aggregated result only
+	colectorBase := conf.Config
+	colectorBase.Expression = ""
+	colectorBase.Schedules = nil
+
+	colectors := make([]Colector, len(conf.Colectors))
+	for i, raw := range conf.Colectors {
+		colectorConf := colectorBase
+		if err := json.Unmarshal(raw, &colectorConf); err != nil {
+			return nil, err
+		}
+		builder, err := colectorFactory(colectorConf.Type)
+		if err != nil {
+			return nil, fmt.Errorf("collector %d: %v", i, err)
+		}
+		if colectors[i], err = builder(colectorBase, string(raw), compositeMetricSuffix(i)); err != nil {
+			return nil, fmt.Errorf("collector %d: %v", i, err)
+		}
+	}
+
+	cruncher, err := scheduledCruncherFactory(conf.Config, compositeCruncherFactory(conf.Aggregation, conf.Colectors))
+	if err != nil {
+		return nil, err
+	}
+
+	return newControllerFromConfig(NewCompositeColector(colectors...), cruncher, conf.Config)
+}
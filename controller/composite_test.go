@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/luizalabs/mitose/config"
+)
+
+type fakeGauge struct {
+	value float64
+}
+
+func (g *fakeGauge) Set(v float64) error {
+	g.value = v
+	return nil
+}
+
+type fakeColector struct {
+	metrics Metrics
+}
+
+func (f *fakeColector) GetMetrics(ctx context.Context) (Metrics, error) {
+	return f.metrics, nil
+}
+
+type fakeCruncher struct{}
+
+func (f *fakeCruncher) CalcDesiredReplicas(ctx context.Context, m Metrics) (int, error) {
+	return strconv.Atoi(m[msgsInQueueMetricName])
+}
+
+func TestCompositeCruncher(t *testing.T) {
+	colector := NewCompositeColector(
+		&fakeColector{Metrics{msgsInQueueMetricName: "3"}},
+		&fakeColector{Metrics{msgsInQueueMetricName: "8"}},
+	)
+	m, err := colector.GetMetrics(context.Background())
+	if err != nil {
+		t.Fatal("error getting composite metrics", err)
+	}
+
+	var testCases = []struct {
+		aggregation string
+		max         int
+		min         int
+		expected    int
+	}{
+		{"", 10, 1, 8},
+		{MaxAggregation, 5, 1, 5},
+		{MinAggregation, 10, 1, 3},
+		{MinAggregation, 10, 4, 4},
+		{AvgAggregation, 10, 1, 6},
+		{SumAggregation, 20, 1, 11},
+	}
+
+	for _, tc := range testCases {
+		g := new(fakeGauge)
+		cruncher, err := NewCompositeCruncher(
+			g, tc.aggregation, tc.max, tc.min, new(fakeCruncher), new(fakeCruncher),
+		)
+		if err != nil {
+			t.Fatal("error creating composite cruncher", err)
+		}
+		actual, err := cruncher.CalcDesiredReplicas(context.Background(), m)
+		if err != nil {
+			t.Fatal("error calculating desired replicas", err)
+		}
+		if actual != tc.expected {
+			t.Errorf("aggregation %q: expected %d, got %d", tc.aggregation, tc.expected, actual)
+		}
+		if g.value != float64(tc.expected) {
+			t.Errorf("aggregation %q: expected gauge %d, got %f", tc.aggregation, tc.expected, g.value)
+		}
+	}
+}
+
+func TestCompositeCruncherInvalidAggregation(t *testing.T) {
+	if _, err := NewCompositeCruncher(new(fakeGauge), "median", 10, 1); err == nil {
+		t.Error("expected error for invalid aggregation")
+	}
+}
+
+func TestCompositeCruncherScaleToZero(t *testing.T) {
+	conf := config.Config{Namespace: "fakeNS", Deployment: "fakeDeploy", Max: 10, MsgsPerPod: 10}
+	colectors := []json.RawMessage{json.RawMessage(`{"type": "sqs"}`), json.RawMessage(`{"type": "pubsub", "msgs_per_pod": 5}`)}
+	cruncher, err := scaleToZero(conf, compositeCruncherFactory("", colectors))
+	if err != nil {
+		t.Fatal("error creating composite cruncher", err)
+	}
+
+	scaleToZero, ok := cruncher.(*ScaleToZeroCruncher)
+	if !ok {
+		t.Fatalf("expected scale to zero around the aggregated cruncher, got %T", cruncher)
+	}
+	composite, ok := scaleToZero.cruncher.(*CompositeCruncher)
+	if !ok {
+		t.Fatalf("expected composite cruncher, got %T", scaleToZero.cruncher)
+	}
+	if composite.min != 1 {
+		t.Errorf("expected min 1 while awake, got %d", composite.min)
+	}
+	for i, c := range composite.crunchers {
+		if _, ok := c.(*RatioCruncher); !ok {
+			t.Errorf("collector %d: expected ratio cruncher, got %T", i, c)
+		}
+	}
+	metricTypes := make(map[string]bool)
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal("error gathering metrics", err)
+	}
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["namespace"] == "fakeNS" && labels["deploy"] == "fakeDeploy" {
+				metricTypes[labels["metric_type"]] = true
+			}
+		}
+	}
+	for _, metricType := range []string{"CRUNCHER", "CRUNCHER_0", "CRUNCHER_1"} {
+		if !metricTypes[metricType] {
+			t.Errorf("expected a %s gauge, got %v", metricType, metricTypes)
+		}
+	}
+}
@@ -2,9 +2,13 @@ package controller
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"strconv"
 	"time"
 
+	"github.com/luizalabs/mitose/external"
+	"github.com/luizalabs/mitose/gauge"
 	"github.com/luizalabs/mitose/k8s"
 )
 
@@ -12,78 +16,175 @@ const (
 	numberOfMessagesInQueueAttrName       = "ApproximateNumberOfMessages"
 	numberOfMessagesInFlightQueueAttrName = "ApproximateNumberOfMessagesNotVisible"
 	msgsInQueueMetricName                 = "msgsInQueue"
+	msgsVisibleMetricName                 = "msgsVisible"
+	msgsInFlightMetricName                = "msgsInFlight"
+	msgsReadyMetricName                   = "msgsReady"
+	msgsUnackedMetricName                 = "msgsUnacked"
+	DeployScaleMethod                     = "DEPLOY"
 	HPAScaleMethod                        = "HPA"
+	JobScaleMethod                        = "JOB"
+	ExternalScaleMethod                   = "EXTERNAL"
+	desiredReplicasMetricName             = "desiredReplicas"
+	// the external metrics of a controller that stops publishing them are
+	// dropped after this number of intervals
+	externalMetricsTTLIntervals = 3
+	// the status of a MitoseAutoscaler is reported after each execution,
+	// with its own deadline
+	statusTimeout = 10 * time.Second
 )
 
 type Metrics map[string]string
 
 type Colector interface {
-	GetMetrics() (Metrics, error)
+	GetMetrics(context.Context) (Metrics, error)
 }
 
 type Cruncher interface {
-	CalcDesiredReplicas(Metrics) (int, error)
+	CalcDesiredReplicas(context.Context, Metrics) (int, error)
 }
 
 type Controller struct {
 	colector    Colector
 	cruncher    Cruncher
-	namespace   string
-	deployment  string
+	target      k8s.Target
 	scaleMethod string
 	interval    time.Duration
+	gPaused     gauge.Gauge
+	gError      gauge.Gauge
+
+	scaleDownProbe *ScaleDownProbe
+	autoscaler     *autoscalerRef
 }
 
+// Run executes c every interval until ctx is done, each execution must finish
+// within the interval.
 func (c *Controller) Run(ctx context.Context) error {
-	log.Printf("start controller for deployment %s (namespace %s)\n", c.deployment, c.namespace)
+	log.Printf("start controller for %s\n", c.target)
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		case <-time.After(c.interval):
-			if err := c.Exec(); err != nil {
+			if err := c.Exec(ctx); err != nil {
 				return err
 			}
 		}
 	}
 }
 
-func (c *Controller) Exec() error {
-	m, err := c.colector.GetMetrics()
+// Exec collects, crunches and scales once within the interval, the status
+// is reported afterwards so a timeout is reported as well.
+func (c *Controller) Exec(ctx context.Context) error {
+	execCtx, cancel := context.WithTimeout(ctx, c.interval)
+	m, desiredReplicas, err := c.exec(execCtx)
+	cancel()
 	if err != nil {
-		return err
+		c.gError.Set(1)
+	} else {
+		c.gError.Set(0)
+	}
+	if c.autoscaler != nil {
+		statusCtx, cancel := context.WithTimeout(ctx, statusTimeout)
+		c.reportStatus(statusCtx, m, desiredReplicas, err)
+		cancel()
+	}
+	return err
+}
+
+func (c *Controller) exec(ctx context.Context) (Metrics, int, error) {
+	m, err := c.colector.GetMetrics(ctx)
+	if err != nil {
+		return nil, 0, err
 	}
-	desiredReplicas, err := c.cruncher.CalcDesiredReplicas(m)
+	if c.scaleMethod == ExternalScaleMethod {
+		c.publishMetrics(m)
+	}
+	desiredReplicas, err := c.cruncher.CalcDesiredReplicas(ctx, m)
+	if err != nil {
+		return m, 0, err
+	}
+	log.Printf("Desired replicas %d for %s\n", desiredReplicas, c.target)
+	return m, desiredReplicas, c.Autoscale(ctx, desiredReplicas)
+}
+
+func (c *Controller) Autoscale(ctx context.Context, desiredReplicas int) error {
+	sources, err := c.overrideAnnotations(ctx)
 	if err != nil {
 		return err
 	}
-	log.Printf(
-		"Desired replicas %d for deployment %s (namespace %s)\n",
-		desiredReplicas,
-		c.deployment,
-		c.namespace,
-	)
-	return c.Autoscale(desiredReplicas)
+	replicas, active := desiredReplicas, true
+	for _, annotations := range sources {
+		var sourceActive bool
+		replicas, sourceActive = applyOverrides(annotations, replicas)
+		active = active && sourceActive
+	}
+	if !active {
+		log.Printf("%s is paused, skipping %d replicas\n", c.target, desiredReplicas)
+		c.gPaused.Set(1)
+		return nil
+	}
+	c.gPaused.Set(0)
+	if replicas != desiredReplicas {
+		log.Printf("%s overrides min replicas, scaling to %d\n", c.target, replicas)
+		desiredReplicas = replicas
+	}
+
+	switch c.scaleMethod {
+	case HPAScaleMethod:
+		return k8s.UpdateHPA(ctx, c.target, desiredReplicas, desiredReplicas)
+	case JobScaleMethod:
+		return k8s.ScaleJobs(ctx, c.target, desiredReplicas)
+	case ExternalScaleMethod:
+		external.Set(c.target.Namespace, c.target.Name, desiredReplicasMetricName, float64(desiredReplicas), c.externalMetricsTTL())
+		return nil
+	default:
+		if c.scaleDownProbe != nil {
+			if err := c.rankPods(ctx, desiredReplicas); err != nil {
+				return err
+			}
+		}
+		return k8s.UpdateTargetReplicasCount(ctx, c.target, desiredReplicas)
+	}
 }
 
-func (c *Controller) Autoscale(desiredReplicas int) error {
-	if c.scaleMethod == HPAScaleMethod {
-		return k8s.UpdateHPA(c.namespace, c.deployment, desiredReplicas, desiredReplicas)
+// publishMetrics exposes the numeric metrics through the external metrics API,
+// leaving the scaling to the HPAs that consume them.
+func (c *Controller) publishMetrics(m Metrics) {
+	for name, value := range m {
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		external.Set(c.target.Namespace, c.target.Name, name, v, c.externalMetricsTTL())
 	}
-	return k8s.UpdateReplicasCount(c.namespace, c.deployment, desiredReplicas)
 }
 
-func NewController(colector Colector, cruncher Cruncher, namespace, deployment, scaleMethod, interval string) (*Controller, error) {
+func (c *Controller) externalMetricsTTL() time.Duration {
+	return externalMetricsTTLIntervals * c.interval
+}
+
+// release undoes what c publishes, once it no longer runs.
+func (c *Controller) release() {
+	if c.scaleMethod == ExternalScaleMethod {
+		external.Delete(c.target.Namespace, c.target.Name)
+	}
+}
+
+func NewController(colector Colector, cruncher Cruncher, target k8s.Target, scaleMethod, interval string) (*Controller, error) {
 	convertedInterval, err := time.ParseDuration(interval)
 	if err != nil {
 		return nil, err
 	}
+	if scaleMethod == JobScaleMethod && !k8s.IsJobKind(target.Kind) {
+		return nil, fmt.Errorf("scale_method %s requires target_kind %s or %s", JobScaleMethod, k8s.JobKind, k8s.CronJobKind)
+	}
 	return &Controller{
 		colector:    colector,
 		cruncher:    cruncher,
-		namespace:   namespace,
-		deployment:  deployment,
+		target:      target,
 		scaleMethod: scaleMethod,
 		interval:    convertedInterval,
+		gPaused:     gauge.NewPrometheusGauge(target.Namespace, target.Name, "PAUSED"),
+		gError:      gauge.NewPrometheusGauge(target.Namespace, target.Name, "ERROR"),
 	}, nil
 }
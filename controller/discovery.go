@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/luizalabs/mitose/k8s"
+)
+
+// AnnotationsConfig is the controller config of a deployment configured by
+// its annotations: each mitose.luizalabs.com/<field> annotation sets the
+// field with its dashes as underscores (e.g. msgs-per-pod), lists are comma
+// separated and schedules, collectors and secret refs are json. The target
+// is always the annotated deployment and active defaults to true. Values
+// that can't be parsed are kept as strings, so Validate reports them, and
+// the cluster and target kind are kept, so ValidateEntry rejects them.
+func AnnotationsConfig(d k8s.AnnotatedDeployment) string {
+	conf := map[string]interface{}{"active": true}
+	fields := make(map[string]reflect.Type)
+	if t, found := controllerConfigs[d.Annotations[k8s.TypeAnnotation]]; found {
+		fields = jsonFields(t)
+	}
+	for annotation, value := range d.Annotations {
+		if annotation == PausedAnnotation || annotation == MinOverrideAnnotation {
+			continue
+		}
+		field := strings.Replace(strings.TrimPrefix(annotation, k8s.AnnotationPrefix), "-", "_", -1)
+		conf[field] = annotationValue(fields[field], value)
+	}
+	conf["namespace"] = d.Namespace
+	conf["deployment"] = d.Name
+	v, _ := json.Marshal(conf)
+	return string(v)
+}
+
+func annotationValue(t reflect.Type, value string) interface{} {
+	if t == nil {
+		return value
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return value
+	case reflect.Bool:
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		if i, err := strconv.Atoi(value); err == nil {
+			return i
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.String {
+			values := strings.Split(value, ",")
+			for i := range values {
+				values[i] = strings.TrimSpace(values[i])
+			}
+			return values
+		}
+		fallthrough
+	default:
+		var v interface{}
+		if err := json.Unmarshal([]byte(value), &v); err == nil {
+			return v
+		}
+	}
+	return value
+}
@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/luizalabs/mitose/k8s"
+)
+
+func TestAnnotationsConfig(t *testing.T) {
+	d := k8s.AnnotatedDeployment{
+		Namespace: "team",
+		Name:      "worker",
+		Annotations: map[string]string{
+			k8s.TypeAnnotation:                         "sqs",
+			k8s.AnnotationPrefix + "interval":          "1m",
+			k8s.AnnotationPrefix + "max":               "20",
+			k8s.AnnotationPrefix + "msgs-per-pod":      "10",
+			k8s.AnnotationPrefix + "tolerance":         "0.2",
+			k8s.AnnotationPrefix + "queue-urls":        "q1, q2",
+			k8s.AnnotationPrefix + "key-secret-ref":    `{"name": "aws", "key": "key"}`,
+			k8s.AnnotationPrefix + "secret-secret-ref": `{"name": "aws", "key": "secret"}`,
+			k8s.AnnotationPrefix + "namespace":         "other",
+			k8s.AnnotationPrefix + "target-kind":       "StatefulSet",
+			PausedAnnotation:                           "true",
+		},
+	}
+	confJSON := AnnotationsConfig(d)
+	if err := Validate(confJSON); err != nil {
+		t.Fatal("unexpected error validating annotations config", err)
+	}
+	conf := SQSControlerConfig{}
+	if err := json.Unmarshal([]byte(confJSON), &conf); err != nil {
+		t.Fatal("error reading annotations config", err)
+	}
+	if conf.Namespace != "team" || conf.Deployment != "worker" {
+		t.Errorf("expected the annotated deployment as target, got %s/%s", conf.Namespace, conf.Deployment)
+	}
+	if _, err := ValidateEntry(Entry{Config: confJSON, Namespace: d.Namespace}); err == nil || !strings.Contains(err.Error(), "target_kind") {
+		t.Errorf("expected target_kind to be rejected, got %v", err)
+	}
+	if !conf.Active || conf.Max != 20 || conf.MsgsPerPod != 10 || conf.Tolerance != 0.2 {
+		t.Errorf("unexpected config %+v", conf.Config)
+	}
+	if !reflect.DeepEqual(conf.QueueURLs, []string{"q1", "q2"}) {
+		t.Errorf("expected q1 and q2 queues, got %v", conf.QueueURLs)
+	}
+	if conf.KeySecretRef == nil || conf.KeySecretRef.Name != "aws" {
+		t.Errorf("expected aws secret ref, got %v", conf.KeySecretRef)
+	}
+
+	d.Annotations[k8s.AnnotationPrefix+"max"] = "many"
+	d.Annotations[k8s.AnnotationPrefix+"msg-per-pod"] = "10"
+	err := Validate(AnnotationsConfig(d))
+	if err == nil {
+		t.Fatal("expected error validating invalid annotations")
+	}
+	for _, expected := range []string{"msg_per_pod: unknown field", "max of type int"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error %q, got %s", expected, err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/luizalabs/mitose/expression"
+	"github.com/luizalabs/mitose/gauge"
+	"github.com/luizalabs/mitose/k8s"
+)
+
+type ExpressionCruncher struct {
+	expression *expression.Expression
+	target     k8s.Target
+	location   *time.Location
+	max        int
+	min        int
+	gMetrics   gauge.Gauge
+}
+
+func (e *ExpressionCruncher) CalcDesiredReplicas(ctx context.Context, m Metrics) (int, error) {
+	vars, err := e.vars(ctx, m)
+	if err != nil {
+		return -1, err
+	}
+	result, err := e.expression.Eval(vars)
+	if err != nil {
+		return -1, fmt.Errorf("evaluating %q: %v", e.expression, err)
+	}
+	if math.IsNaN(result) {
+		return -1, fmt.Errorf("expression %q evaluated to %f", e.expression, result)
+	}
+
+	// clamped before the conversion, huge results (or infinities) overflow int
+	desired := math.Ceil(result)
+	if desired > float64(e.max) {
+		desired = float64(e.max)
+	} else if desired < float64(e.min) {
+		desired = float64(e.min)
+	}
+	desiredReplicas := int(desired)
+	e.gMetrics.Set(desired)
+	return desiredReplicas, nil
+}
+
+func (e *ExpressionCruncher) vars(ctx context.Context, m Metrics) (expression.Vars, error) {
+	replicas, err := k8s.GetTargetReplicasCount(ctx, e.target)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().In(e.location)
+	vars := expression.Vars{
+		"replicas": float64(replicas),
+		"min":      float64(e.min),
+		"max":      float64(e.max),
+		"hour":     float64(now.Hour()),
+		"minute":   float64(now.Minute()),
+		"weekday":  float64(now.Weekday()),
+	}
+	for name, value := range m {
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, err
+		}
+		vars[name] = v
+	}
+	return vars, nil
+}
+
+func NewExpressionCruncher(g gauge.Gauge, expr, timezone string, target k8s.Target, max, min int) (Cruncher, error) {
+	parsed, err := expression.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, err
+	}
+	return &ExpressionCruncher{
+		expression: parsed,
+		target:     target,
+		location:   location,
+		max:        max,
+		min:        min,
+		gMetrics:   g,
+	}, nil
+}
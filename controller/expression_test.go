@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/luizalabs/mitose/k8s"
+)
+
+func TestExpressionCruncherClamp(t *testing.T) {
+	clientBuilder := k8s.ClientBuilder
+	k8s.ClientBuilder = fakeDeployBuilder("fakeNS", "fakeDeploy", 1)
+	defer func() { k8s.ClientBuilder = clientBuilder }()
+
+	var testCases = []struct {
+		expression string
+		expected   int
+	}{
+		{"msgsInQueue / 10", 3},
+		{"msgsInQueue * 1000000000000000000000", 20},
+		{"msgsInQueue / 0.0000000000000000000001", 20},
+		{"-msgsInQueue / 0.0000000000000000000001", 2},
+		{"-msgsInQueue * 1000000000000000000000", 2},
+	}
+
+	for _, tc := range testCases {
+		cruncher, err := NewExpressionCruncher(new(fakeGauge), tc.expression, "UTC", fakeTarget, 20, 2)
+		if err != nil {
+			t.Fatal("error creating expression cruncher", err)
+		}
+		actual, err := cruncher.CalcDesiredReplicas(context.Background(), Metrics{msgsInQueueMetricName: "25"})
+		if err != nil {
+			t.Fatalf("error calculating %q: %v", tc.expression, err)
+		}
+		if actual != tc.expected {
+			t.Errorf("%q: expected %d, got %d", tc.expression, tc.expected, actual)
+		}
+	}
+
+	cruncher, err := NewExpressionCruncher(new(fakeGauge), "msgsInQueue / msgsInQueue", "UTC", fakeTarget, 20, 2)
+	if err != nil {
+		t.Fatal("error creating expression cruncher", err)
+	}
+	if _, err := cruncher.CalcDesiredReplicas(context.Background(), Metrics{msgsInQueueMetricName: "0"}); err == nil {
+		t.Error("expected error when the expression evaluates to NaN")
+	}
+}
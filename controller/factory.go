@@ -1,6 +1,19 @@
 package controller
 
-import "errors"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/luizalabs/mitose/config"
+	"github.com/luizalabs/mitose/gauge"
+	"github.com/luizalabs/mitose/k8s"
+)
+
+// colectorBuilder builds the colector of confJSON, metricSuffix tells apart
+// the gauges of the collectors of a composite.
+type colectorBuilder func(base config.Config, confJSON, metricSuffix string) (Colector, error)
 
 func Factory(controllerType, conf string) (*Controller, error) {
 	switch controllerType {
@@ -10,7 +23,184 @@ func Factory(controllerType, conf string) (*Controller, error) {
 		return NewPubSubController(conf)
 	case "rabbitmq":
 		return NewRabbitMQController(conf)
+	case "composite":
+		return NewCompositeController(conf)
 	default:
 		return nil, errors.New("invalid controller type")
 	}
 }
+
+func colectorFactory(colectorType string) (colectorBuilder, error) {
+	switch colectorType {
+	case "sqs":
+		return buildSQSColector, nil
+	case "pubsub":
+		return buildPubSubColector, nil
+	case "rabbitmq":
+		return buildRabbitMQColector, nil
+	default:
+		return nil, errors.New("invalid colector type")
+	}
+}
+
+func cruncherFactory(conf config.Config) (Cruncher, error) {
+	return scheduledCruncherFactory(conf, newCruncher)
+}
+
+// scheduledCruncherFactory builds the crunchers of conf and of its schedules
+// with build, wrapped in a single ScaleToZeroCruncher when a min is zero.
+func scheduledCruncherFactory(conf config.Config, build cruncherBuilder) (Cruncher, error) {
+	if len(conf.Schedules) == 0 {
+		return scaleToZero(conf, build)
+	}
+	return NewScheduleCruncher(conf, build)
+}
+
+// scaleToZero wraps the cruncher built from conf in a ScaleToZeroCruncher
+// when its min is zero.
+func scaleToZero(conf config.Config, build cruncherBuilder) (Cruncher, error) {
+	if conf.Min != 0 {
+		return build(conf)
+	}
+	cruncher, err := build(awake(conf))
+	if err != nil {
+		return nil, err
+	}
+	return newScaleToZeroCruncher(conf, cruncher)
+}
+
+// awake is conf with a zero min raised to one, while awake the deployment
+// keeps at least one replica.
+func awake(conf config.Config) config.Config {
+	if conf.Min == 0 {
+		conf.Min = 1
+	}
+	return conf
+}
+
+func newScaleToZeroCruncher(conf config.Config, cruncher Cruncher) (Cruncher, error) {
+	if err := checkScaleToZero(conf); err != nil {
+		return nil, err
+	}
+	return NewScaleToZeroCruncher(
+		gauge.NewPrometheusGauge(conf.Namespace, conf.Deployment, "CRUNCHER"),
+		cruncher,
+		targetFromConfig(conf),
+		conf.ActivationThreshold,
+		conf.IdlePeriod,
+		conf.InitialReplicas,
+	)
+}
+
+func newCruncher(conf config.Config) (Cruncher, error) {
+	return buildCruncher(conf, "")
+}
+
+func buildCruncher(conf config.Config, metricSuffix string) (Cruncher, error) {
+	g := gauge.NewPrometheusGauge(conf.Namespace, conf.Deployment, "CRUNCHER"+metricSuffix)
+	if conf.Expression != "" {
+		return NewExpressionCruncher(
+			g,
+			conf.Expression,
+			conf.Timezone,
+			targetFromConfig(conf),
+			conf.Max,
+			conf.Min,
+		)
+	}
+	// the HPA applies its own tolerance to the replicas set on it
+	tolerance := conf.Tolerance
+	if conf.ScaleMethod == HPAScaleMethod {
+		tolerance = 0
+	}
+	return NewRatioCruncher(
+		g,
+		targetFromConfig(conf),
+		conf.Max,
+		conf.Min,
+		conf.MsgsPerPod,
+		conf.Rounding,
+		tolerance,
+	)
+}
+
+func buildController(confJSON string, builder colectorBuilder) (*Controller, error) {
+	conf := new(config.Config)
+	if err := json.Unmarshal([]byte(confJSON), conf); err != nil {
+		return nil, err
+	}
+
+	colector, err := builder(*conf, confJSON, "")
+	if err != nil {
+		return nil, err
+	}
+	cruncher, err := cruncherFactory(*conf)
+	if err != nil {
+		return nil, err
+	}
+
+	return newControllerFromConfig(colector, cruncher, *conf)
+}
+
+func newControllerFromConfig(colector Colector, cruncher Cruncher, conf config.Config) (*Controller, error) {
+	target := targetFromConfig(conf)
+	c, err := NewController(colector, cruncher, target, conf.ScaleMethod, conf.Interval)
+	if err != nil {
+		return nil, err
+	}
+	if conf.ScaleDownProbePort != 0 {
+		if err := checkScaleDownProbe(conf); err != nil {
+			return nil, err
+		}
+		if target.Cluster == "" {
+			c.scaleDownProbe = NewScaleDownProbe(conf.ScaleDownProbePort, conf.ScaleDownProbePath)
+		} else {
+			// the pod IPs of other clusters aren't reachable
+			log.Printf("ignoring scale_down_probe_port of %s, the pods of other clusters can't be probed\n", target)
+		}
+	}
+	return c, nil
+}
+
+// checkScaleToZero rejects a zero min, of conf or of its schedules, with the
+// scale methods whose HPA keeps at least one replica.
+func checkScaleToZero(conf config.Config) error {
+	if conf.ScaleMethod != HPAScaleMethod && conf.ScaleMethod != ExternalScaleMethod {
+		return nil
+	}
+	scalesToZero := conf.Min == 0
+	for _, s := range conf.Schedules {
+		scalesToZero = scalesToZero || s.Apply(conf).Min == 0
+	}
+	if scalesToZero {
+		return fmt.Errorf("min: scale_method %s can't scale to zero, every min must be at least 1", conf.ScaleMethod)
+	}
+	return nil
+}
+
+// checkScaleDownProbe rejects scale_down_probe_port unless conf scales the
+// replicas of a deployment, the only pods mitose ranks before a scale down.
+func checkScaleDownProbe(conf config.Config) error {
+	if conf.ScaleDownProbePort == 0 {
+		return nil
+	}
+	switch {
+	case conf.TargetKind != "", conf.ScaleMethod == HPAScaleMethod, conf.ScaleMethod == JobScaleMethod, conf.ScaleMethod == ExternalScaleMethod:
+		return errors.New("scale_down_probe_port: only supported when scaling deployments")
+	}
+	return nil
+}
+
+func targetFromConfig(conf config.Config) k8s.Target {
+	kind := conf.TargetKind
+	if kind == "" && conf.ScaleMethod == JobScaleMethod {
+		kind = k8s.JobKind
+	}
+	return k8s.Target{
+		Cluster:    conf.Cluster,
+		Namespace:  conf.Namespace,
+		Name:       conf.Deployment,
+		APIVersion: conf.TargetAPIVersion,
+		Kind:       kind,
+	}
+}
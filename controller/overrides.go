@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"strconv"
+
+	"github.com/luizalabs/mitose/k8s"
+)
+
+const (
+	PausedAnnotation      = "mitose.luizalabs.com/paused"
+	MinOverrideAnnotation = "mitose.luizalabs.com/min-override"
+)
+
+// applyOverrides honours the annotations set by hand on the target, returning
+// the replicas to write or false when the target is paused.
+func applyOverrides(annotations map[string]string, desiredReplicas int) (int, bool) {
+	if paused, _ := strconv.ParseBool(annotations[PausedAnnotation]); paused {
+		return desiredReplicas, false
+	}
+	if value, found := annotations[MinOverrideAnnotation]; found {
+		min, err := strconv.Atoi(value)
+		if err != nil || min < 0 {
+			log.Printf("ignoring invalid %s annotation %q\n", MinOverrideAnnotation, value)
+		} else if desiredReplicas < min {
+			return min, true
+		}
+	}
+	return desiredReplicas, true
+}
+
+// overrideAnnotations are the annotations of the target and, in HPA mode,
+// the ones of its HPA, each of them can pause or override the min.
+func (c *Controller) overrideAnnotations(ctx context.Context) ([]map[string]string, error) {
+	annotations, err := k8s.GetTargetAnnotations(ctx, c.target)
+	if err != nil {
+		return nil, err
+	}
+	if c.scaleMethod != HPAScaleMethod {
+		return []map[string]string{annotations}, nil
+	}
+	hpaAnnotations, err := k8s.GetHPAAnnotations(ctx, c.target)
+	if err != nil {
+		return nil, err
+	}
+	return []map[string]string{annotations, hpaAnnotations}, nil
+}
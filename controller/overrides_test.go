@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/luizalabs/mitose/k8s"
+)
+
+func TestApplyOverrides(t *testing.T) {
+	var testCases = []struct {
+		annotations      map[string]string
+		desiredReplicas  int
+		expectedReplicas int
+		expectedActive   bool
+	}{
+		{nil, 3, 3, true},
+		{map[string]string{PausedAnnotation: "true"}, 3, 3, false},
+		{map[string]string{PausedAnnotation: "false"}, 3, 3, true},
+		{map[string]string{MinOverrideAnnotation: "10"}, 3, 10, true},
+		{map[string]string{MinOverrideAnnotation: "10"}, 12, 12, true},
+		{map[string]string{MinOverrideAnnotation: "ten"}, 3, 3, true},
+		{map[string]string{PausedAnnotation: "true", MinOverrideAnnotation: "10"}, 3, 3, false},
+	}
+
+	for _, tc := range testCases {
+		replicas, active := applyOverrides(tc.annotations, tc.desiredReplicas)
+		if replicas != tc.expectedReplicas || active != tc.expectedActive {
+			t.Errorf(
+				"%v with %d replicas: expected (%d, %t), got (%d, %t)",
+				tc.annotations,
+				tc.desiredReplicas,
+				tc.expectedReplicas,
+				tc.expectedActive,
+				replicas,
+				active,
+			)
+		}
+	}
+}
+
+func TestOverrideAnnotationsHPA(t *testing.T) {
+	deploy := &appsv1.Deployment{}
+	deploy.Namespace, deploy.Name = "fakeNS", "fakeDeploy"
+	deploy.Annotations = map[string]string{PausedAnnotation: "true"}
+	hpa := &autoscalingv1.HorizontalPodAutoscaler{}
+	hpa.Namespace, hpa.Name = "fakeNS", "fakeDeploy"
+	hpa.Annotations = map[string]string{MinOverrideAnnotation: "10"}
+	fakeK8sClient := fake.NewSimpleClientset(deploy, hpa)
+	fakeK8sClient.Resources = []*metav1.APIResourceList{{GroupVersion: "apps/v1"}}
+	clientBuilder := k8s.ClientBuilder
+	k8s.ClientBuilder = func(string) (kubernetes.Interface, error) { return fakeK8sClient, nil }
+	defer func() { k8s.ClientBuilder = clientBuilder }()
+
+	c := &Controller{target: fakeTarget, scaleMethod: HPAScaleMethod}
+	sources, err := c.overrideAnnotations(context.Background())
+	if err != nil {
+		t.Fatal("error reading override annotations", err)
+	}
+	if len(sources) != 2 || sources[0][PausedAnnotation] != "true" || sources[1][MinOverrideAnnotation] != "10" {
+		t.Errorf("expected the annotations of the deployment and of the HPA, got %v", sources)
+	}
+}
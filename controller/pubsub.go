@@ -1,8 +1,8 @@
 package controller
 
 import (
+	"context"
 	"encoding/json"
-	"math"
 	"strconv"
 
 	"github.com/luizalabs/mitose/config"
@@ -12,11 +12,11 @@ import (
 
 type PubSubControlerConfig struct {
 	config.Config
-	GoogleApplicationCredentials string   `json:"google_application_credentials"`
-	Region                       string   `json:"region"`
-	SubscriptionIDs              []string `json:"subscription_ids"`
-	Project                      string   `json:"project"`
-	MsgsPerPod                   int      `json:"msgs_per_pod"`
+	GoogleApplicationCredentials          string            `json:"google_application_credentials"`
+	GoogleApplicationCredentialsSecretRef *config.SecretRef `json:"google_application_credentials_secret_ref"`
+	Region                                string            `json:"region"`
+	SubscriptionIDs                       []string          `json:"subscription_ids"`
+	Project                               string            `json:"project"`
 }
 
 type PubSubColector struct {
@@ -25,17 +25,10 @@ type PubSubColector struct {
 	gMetrics        gauge.Gauge
 }
 
-type PubSubCruncher struct {
-	max        int
-	min        int
-	msgsPerPod int
-	gMetrics   gauge.Gauge
-}
-
-func (s *PubSubColector) GetMetrics() (Metrics, error) {
+func (s *PubSubColector) GetMetrics(ctx context.Context) (Metrics, error) {
 	msgsInQueue := 0
 	for _, queueURL := range s.subscriptionIDs {
-		n, err := s.cli.GetNumOfUndeliveredMessages(queueURL)
+		n, err := s.cli.GetNumOfUndeliveredMessages(ctx, queueURL)
 		if err != nil {
 			return nil, err
 		}
@@ -45,57 +38,31 @@ func (s *PubSubColector) GetMetrics() (Metrics, error) {
 	return Metrics{msgsInQueueMetricName: strconv.Itoa(msgsInQueue)}, nil
 }
 
-func (s *PubSubCruncher) CalcDesiredReplicas(m Metrics) (int, error) {
-	desiredReplicas, err := s.calcReplicas(m)
-	if err != nil {
-		return -1, err
-	}
-	s.gMetrics.Set(float64(desiredReplicas))
-	return desiredReplicas, nil
-}
-
-func (s *PubSubCruncher) calcReplicas(m Metrics) (int, error) {
-	msgsInQueue, err := strconv.Atoi(m[msgsInQueueMetricName])
-	if err != nil {
-		return -1, err
-	}
-	desiredReplicas := float64(msgsInQueue) / float64(s.msgsPerPod)
-	if desiredReplicas > float64(s.max) {
-		return s.max, nil
-	} else if desiredReplicas < float64(s.min) {
-		return s.min, nil
-	}
-	desiredReplicas = math.Ceil(desiredReplicas)
-	return int(desiredReplicas), nil
-}
-
 func NewPubSubColector(g gauge.Gauge, googleApplicationCredentials, gcpProject, gcpRegion string, subscriptionIDs ...string) Colector {
 	cli := pubsub.NewPubSubClient(googleApplicationCredentials, gcpProject, gcpRegion)
 	return &PubSubColector{subscriptionIDs: subscriptionIDs, cli: cli, gMetrics: g}
 }
 
-func NewPubSubCruncher(g gauge.Gauge, max, min, msgsPerPod int) Cruncher {
-	return &PubSubCruncher{max: max, min: min, msgsPerPod: msgsPerPod, gMetrics: g}
-}
-
-func NewPubSubController(confJSON string) (*Controller, error) {
-	conf := new(PubSubControlerConfig)
+func buildPubSubColector(base config.Config, confJSON, metricSuffix string) (Colector, error) {
+	conf := &PubSubControlerConfig{Config: base}
 	if err := json.Unmarshal([]byte(confJSON), conf); err != nil {
 		return nil, err
 	}
 
-	gColector := gauge.NewPrometheusGauge(conf.Namespace, conf.Deployment, "PubSub")
-	colector := NewPubSubColector(gColector, conf.GoogleApplicationCredentials, conf.Project, conf.Region, conf.SubscriptionIDs...)
+	gColector := gauge.NewPrometheusGauge(conf.Namespace, conf.Deployment, "PubSub"+metricSuffix)
+	if conf.GoogleApplicationCredentialsSecretRef == nil {
+		return NewPubSubColector(gColector, conf.GoogleApplicationCredentials, conf.Project, conf.Region, conf.SubscriptionIDs...), nil
+	}
 
-	gCruncher := gauge.NewPrometheusGauge(conf.Namespace, conf.Deployment, "CRUNCHER")
-	cruncher := NewPubSubCruncher(gCruncher, conf.Max, conf.Min, conf.MsgsPerPod)
+	// the secret holds the content of the credentials file
+	credentialsJSON, err := secretValue(base, conf.GoogleApplicationCredentialsSecretRef, "")
+	if err != nil {
+		return nil, err
+	}
+	cli := pubsub.NewPubSubClientWithCredentialsJSON([]byte(credentialsJSON), conf.Project, conf.Region)
+	return &PubSubColector{subscriptionIDs: conf.SubscriptionIDs, cli: cli, gMetrics: gColector}, nil
+}
 
-	return NewController(
-		colector,
-		cruncher,
-		conf.Namespace,
-		conf.Deployment,
-		conf.ScaleMethod,
-		conf.Interval,
-	)
+func NewPubSubController(confJSON string) (*Controller, error) {
+	return buildController(confJSON, buildPubSubColector)
 }
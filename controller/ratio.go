@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/luizalabs/mitose/gauge"
+	"github.com/luizalabs/mitose/k8s"
+)
+
+const (
+	CeilRounding  = "ceil"
+	FloorRounding = "floor"
+	RoundRounding = "round"
+)
+
+// RatioCruncher calculates the desired replicas as the number of messages
+// divided by the number of messages each replica should handle.
+type RatioCruncher struct {
+	target     k8s.Target
+	max        int
+	min        int
+	msgsPerPod int
+	rounding   string
+	tolerance  float64
+	gMetrics   gauge.Gauge
+}
+
+func (r *RatioCruncher) CalcDesiredReplicas(ctx context.Context, m Metrics) (int, error) {
+	desiredReplicas, err := r.calcReplicas(ctx, m)
+	if err != nil {
+		return -1, err
+	}
+	r.gMetrics.Set(float64(desiredReplicas))
+	return desiredReplicas, nil
+}
+
+func (r *RatioCruncher) calcReplicas(ctx context.Context, m Metrics) (int, error) {
+	msgsInQueue, err := strconv.Atoi(m[msgsInQueueMetricName])
+	if err != nil {
+		return -1, err
+	}
+	ratio := float64(msgsInQueue) / float64(r.msgsPerPod)
+
+	if r.tolerance > 0 {
+		currentReplicas, err := k8s.GetTargetReplicasCount(ctx, r.target)
+		if err != nil {
+			return -1, err
+		}
+		// like the HPA, small changes around the current replicas are ignored
+		if currentReplicas > 0 && math.Abs(ratio/float64(currentReplicas)-1) <= r.tolerance {
+			ratio = float64(currentReplicas)
+		}
+	}
+
+	desiredReplicas := int(r.round(ratio))
+	if desiredReplicas > r.max {
+		return r.max, nil
+	} else if desiredReplicas < r.min {
+		return r.min, nil
+	}
+	return desiredReplicas, nil
+}
+
+func (r *RatioCruncher) round(v float64) float64 {
+	switch r.rounding {
+	case FloorRounding:
+		return math.Floor(v)
+	case RoundRounding:
+		return math.Round(v)
+	default:
+		return math.Ceil(v)
+	}
+}
+
+// NewRatioCruncher validates the scaling parameters and returns a RatioCruncher,
+// a zero tolerance disables it.
+func NewRatioCruncher(g gauge.Gauge, target k8s.Target, max, min, msgsPerPod int, rounding string, tolerance float64) (Cruncher, error) {
+	if msgsPerPod <= 0 {
+		return nil, errors.New("msgs_per_pod must be greater than zero")
+	}
+	if min < 0 {
+		return nil, errors.New("min must not be negative")
+	}
+	if max < min {
+		return nil, errors.New("max must be greater than or equal to min")
+	}
+	switch rounding {
+	case "":
+		rounding = CeilRounding
+	case CeilRounding, FloorRounding, RoundRounding:
+	default:
+		return nil, fmt.Errorf("invalid rounding %q", rounding)
+	}
+	if tolerance < 0 || tolerance >= 1 {
+		return nil, errors.New("tolerance must be between 0 and 1")
+	}
+
+	return &RatioCruncher{
+		target:     target,
+		max:        max,
+		min:        min,
+		msgsPerPod: msgsPerPod,
+		rounding:   rounding,
+		tolerance:  tolerance,
+		gMetrics:   g,
+	}, nil
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/luizalabs/mitose/config"
+	"github.com/luizalabs/mitose/k8s"
+)
+
+var fakeTarget = k8s.Target{Namespace: "fakeNS", Name: "fakeDeploy"}
+
+func fakeDeployBuilder(namespace, name string, replicas int32) func(string) (kubernetes.Interface, error) {
+	fakeDeploy := &appsv1.Deployment{
+		Spec: appsv1.DeploymentSpec{Replicas: &replicas},
+	}
+	fakeDeploy.Name = name
+	fakeDeploy.Namespace = namespace
+	fakeK8sClient := fake.NewSimpleClientset(fakeDeploy)
+	fakeK8sClient.Resources = []*metav1.APIResourceList{{GroupVersion: "apps/v1"}}
+	return func(string) (kubernetes.Interface, error) { return fakeK8sClient, nil }
+}
+
+func TestRatioCruncher(t *testing.T) {
+
+	var testCases = []struct {
+		msgsInQueue string
+		rounding    string
+		expected    int
+	}{
+		{"0", "", 1},
+		{"25", "", 3},
+		{"25", CeilRounding, 3},
+		{"25", FloorRounding, 2},
+		{"25", RoundRounding, 3},
+		{"24", RoundRounding, 2},
+		{"95", "", 10},
+		{"1000", "", 10},
+	}
+
+	for _, tc := range testCases {
+		g := new(fakeGauge)
+		cruncher, err := NewRatioCruncher(g, fakeTarget, 10, 1, 10, tc.rounding, 0)
+		if err != nil {
+			t.Fatal("error creating ratio cruncher", err)
+		}
+		actual, err := cruncher.CalcDesiredReplicas(context.Background(), Metrics{msgsInQueueMetricName: tc.msgsInQueue})
+		if err != nil {
+			t.Fatal("error calculating desired replicas", err)
+		}
+		if actual != tc.expected {
+			t.Errorf("%s msgs (%q): expected %d, got %d", tc.msgsInQueue, tc.rounding, tc.expected, actual)
+		}
+		if g.value != float64(tc.expected) {
+			t.Errorf("expected gauge %d, got %f", tc.expected, g.value)
+		}
+	}
+}
+
+func TestRatioCruncherTolerance(t *testing.T) {
+	clientBuilder := k8s.ClientBuilder
+	k8s.ClientBuilder = fakeDeployBuilder("fakeNS", "fakeDeploy", 10)
+	defer func() { k8s.ClientBuilder = clientBuilder }()
+
+	var testCases = []struct {
+		msgsInQueue string
+		expected    int
+	}{
+		{"95", 10},
+		{"109", 10},
+		{"111", 12},
+		{"85", 9},
+	}
+
+	for _, tc := range testCases {
+		cruncher, err := NewRatioCruncher(new(fakeGauge), fakeTarget, 20, 1, 10, "", 0.1)
+		if err != nil {
+			t.Fatal("error creating ratio cruncher", err)
+		}
+		actual, err := cruncher.CalcDesiredReplicas(context.Background(), Metrics{msgsInQueueMetricName: tc.msgsInQueue})
+		if err != nil {
+			t.Fatal("error calculating desired replicas", err)
+		}
+		if actual != tc.expected {
+			t.Errorf("%s msgs: expected %d, got %d", tc.msgsInQueue, tc.expected, actual)
+		}
+	}
+}
+
+func TestRatioCruncherToleranceHPA(t *testing.T) {
+	conf := config.Config{Namespace: "fakeNS", Deployment: "fakeDeploy", ScaleMethod: HPAScaleMethod, Max: 20, Min: 1, MsgsPerPod: 10, Tolerance: 0.1}
+	cruncher, err := newCruncher(conf)
+	if err != nil {
+		t.Fatal("error creating ratio cruncher", err)
+	}
+	if tolerance := cruncher.(*RatioCruncher).tolerance; tolerance != 0 {
+		t.Errorf("expected the tolerance to be left to the HPA, got %f", tolerance)
+	}
+}
+
+func TestNewRatioCruncherValidation(t *testing.T) {
+	var testCases = []struct {
+		max        int
+		min        int
+		msgsPerPod int
+		rounding   string
+		tolerance  float64
+	}{
+		{10, 1, 0, "", 0},
+		{10, -1, 10, "", 0},
+		{1, 10, 10, "", 0},
+		{10, 1, 10, "trunc", 0},
+		{10, 1, 10, "", -0.1},
+	}
+
+	for _, tc := range testCases {
+		_, err := NewRatioCruncher(new(fakeGauge), fakeTarget, tc.max, tc.min, tc.msgsPerPod, tc.rounding, tc.tolerance)
+		if err == nil {
+			t.Errorf("expected error for %+v", tc)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/luizalabs/mitose/config"
+	"github.com/luizalabs/mitose/gauge"
+	"github.com/luizalabs/mitose/k8s"
+)
+
+const (
+	initialRestartBackoff = 5 * time.Second
+	maxRestartBackoff     = 5 * time.Minute
+)
+
+// Entry is the configuration of one controller, from a configmap entry, a
+// MitoseAutoscaler (then Autoscaler is set) or an annotated deployment.
+// Namespace is set for the entries owned by a namespace, which can only read
+// its secrets.
+type Entry struct {
+	Config     string
+	Autoscaler *k8s.Autoscaler
+	Namespace  string
+}
+
+type runningController struct {
+	version string
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+type invalidEntry struct {
+	entry   Entry
+	version string
+}
+
+// Reconciler keeps one running controller for each active entry, only the
+// controllers whose entry changed are stopped or restarted, the others keep
+// their timers and state. Each controller is isolated: a failing one is
+// restarted with exponential backoff and an invalid entry is skipped and
+// reported without affecting the others.
+type Reconciler struct {
+	ctx      context.Context
+	running  map[string]*runningController
+	stopping map[string]<-chan struct{}
+	invalid  map[string]invalidEntry
+	build    func(Entry) (*Controller, error)
+	backoff  time.Duration
+}
+
+func NewReconciler(ctx context.Context) *Reconciler {
+	return &Reconciler{
+		ctx:      ctx,
+		running:  make(map[string]*runningController),
+		stopping: make(map[string]<-chan struct{}),
+		invalid:  make(map[string]invalidEntry),
+		build:    buildFromEntry,
+		backoff:  initialRestartBackoff,
+	}
+}
+
+// Reconcile starts the controllers of new entries, stops the ones of removed
+// or inactive entries and restarts the ones whose config or secrets changed.
+// It doesn't wait for the stopped controllers, their replacements do.
+func (r *Reconciler) Reconcile(entries map[string]Entry) {
+	for key, done := range r.stopping {
+		select {
+		case <-done:
+			delete(r.stopping, key)
+		default:
+		}
+	}
+
+	versions := make(map[string]string, len(entries))
+	for key, entry := range entries {
+		versions[key] = entry.Config + "\n" + secretsVersion(entry.Config)
+	}
+	stopUnusedSecrets(entries)
+
+	for key, rc := range r.running {
+		if version, found := versions[key]; found && version == rc.version {
+			continue
+		}
+		rc.cancel()
+		r.stopping[key] = rc.done
+		delete(r.running, key)
+		log.Printf("controller %s stopped\n", key)
+	}
+	for key, invalid := range r.invalid {
+		if version, found := versions[key]; !found || version != invalid.version {
+			errorGauge(key, invalid.entry).Set(0)
+			delete(r.invalid, key)
+		}
+	}
+
+	for key, entry := range entries {
+		if _, found := r.running[key]; found {
+			continue
+		}
+		if _, found := r.invalid[key]; found {
+			continue
+		}
+		c, err := r.build(entry)
+		if err != nil {
+			r.invalid[key] = invalidEntry{entry: entry, version: versions[key]}
+			reportInvalidEntry(r.ctx, key, entry, err)
+			continue
+		}
+		if c == nil {
+			continue
+		}
+		r.start(key, versions[key], c)
+	}
+}
+
+// Stop stops every running controller and waits for the stopped ones.
+func (r *Reconciler) Stop() {
+	for key, rc := range r.running {
+		rc.stop()
+		delete(r.running, key)
+	}
+	for key, done := range r.stopping {
+		<-done
+		delete(r.stopping, key)
+	}
+}
+
+// start runs c until its context is canceled, restarting it after each error
+// with a backoff that doubles up to maxRestartBackoff and is reset once the
+// controller runs longer than it. The previous controller of key is waited
+// first, so two controllers never scale the same target.
+func (r *Reconciler) start(key, version string, c *Controller) {
+	ctx, cancel := context.WithCancel(r.ctx)
+	rc := &runningController{version: version, cancel: cancel, done: make(chan struct{})}
+	r.running[key] = rc
+	previous := r.stopping[key]
+	delete(r.stopping, key)
+	go func() {
+		defer close(rc.done)
+		defer c.release()
+		if previous != nil {
+			select {
+			case <-ctx.Done():
+				<-previous
+				return
+			case <-previous:
+			}
+		}
+		backoff := r.backoff
+		for {
+			started := time.Now()
+			err := c.Run(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			if time.Since(started) > maxRestartBackoff {
+				backoff = r.backoff
+			}
+			log.Printf("controller %s failed, restarting in %s: %s\n", key, backoff, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > maxRestartBackoff {
+				backoff = maxRestartBackoff
+			}
+		}
+	}()
+}
+
+// stop waits for the controller to return.
+func (rc *runningController) stop() {
+	rc.cancel()
+	<-rc.done
+}
+
+// ValidateEntry returns whether entry is active, with an error listing every
+// problem of an invalid active entry.
+func ValidateEntry(entry Entry) (bool, error) {
+	conf := new(config.Config)
+	if err := json.Unmarshal([]byte(entry.Config), conf); err != nil {
+		return false, err
+	}
+	if !conf.Active {
+		return false, nil
+	}
+	if err := Validate(entry.Config); err != nil {
+		return true, err
+	}
+	if entry.Namespace != "" {
+		if err := checkNamespacedTarget(*conf); err != nil {
+			return true, err
+		}
+		if err := checkSecretNamespaces(entry.Config, entry.Namespace); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// checkNamespacedTarget rejects the fields that would move the target of an
+// entry owned by a namespace to another cluster or kind, the namespace itself
+// is forced by the entry source.
+func checkNamespacedTarget(conf config.Config) error {
+	fields := make([]string, 0)
+	if conf.Cluster != "" {
+		fields = append(fields, "cluster")
+	}
+	if conf.TargetKind != "" {
+		fields = append(fields, "target_kind")
+	}
+	if conf.TargetAPIVersion != "" {
+		fields = append(fields, "target_api_version")
+	}
+	if len(fields) > 0 {
+		return fmt.Errorf("%s not allowed on namespaced controllers", strings.Join(fields, ", "))
+	}
+	return nil
+}
+
+// buildFromEntry returns nil for inactive entries.
+func buildFromEntry(entry Entry) (*Controller, error) {
+	active, err := ValidateEntry(entry)
+	if !active || err != nil {
+		return nil, err
+	}
+	conf := new(config.Config)
+	json.Unmarshal([]byte(entry.Config), conf)
+	c, err := Factory(conf.Type, entry.Config)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Autoscaler != nil {
+		c.ReportTo(*entry.Autoscaler)
+	}
+	return c, nil
+}
+
+// reportInvalidEntry logs the error, sets the ERROR gauge and, for a
+// MitoseAutoscaler, its status.
+func reportInvalidEntry(ctx context.Context, key string, entry Entry, err error) {
+	log.Printf("skipping invalid controller %s: %s\n", key, err)
+	errorGauge(key, entry).Set(1)
+
+	if a := entry.Autoscaler; a != nil {
+		status := k8s.AutoscalerStatus{ObservedGeneration: a.Generation, Error: err.Error()}
+		if err := k8s.UpdateAutoscalerStatus(ctx, a.Namespace, a.Name, status); err != nil {
+			log.Printf("error updating status of %s %s/%s: %s\n", k8s.AutoscalerKind, a.Namespace, a.Name, err)
+		}
+	}
+}
+
+// errorGauge is the ERROR gauge of the target of entry, or of the entry key
+// when the target can't be read.
+func errorGauge(key string, entry Entry) gauge.Gauge {
+	conf := new(config.Config)
+	json.Unmarshal([]byte(entry.Config), conf)
+	namespace, name := conf.Namespace, conf.Deployment
+	if name == "" {
+		name = key
+	}
+	return gauge.NewPrometheusGauge(namespace, name, "ERROR")
+}
@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type failingColector struct {
+	calls int32
+}
+
+func (f *failingColector) GetMetrics(ctx context.Context) (Metrics, error) {
+	atomic.AddInt32(&f.calls, 1)
+	return nil, errors.New("fake error")
+}
+
+// hungColector ignores its context until released, like a client without
+// deadlines.
+type hungColector struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (h *hungColector) GetMetrics(ctx context.Context) (Metrics, error) {
+	h.started <- struct{}{}
+	<-h.release
+	return nil, ctx.Err()
+}
+
+func TestReconcile(t *testing.T) {
+	r := NewReconciler(context.Background())
+	defer r.Stop()
+	built := make(map[string]int)
+	r.build = func(entry Entry) (*Controller, error) {
+		built[entry.Config]++
+		if entry.Config == "inactive" {
+			return nil, nil
+		}
+		return &Controller{interval: time.Hour}, nil
+	}
+
+	r.Reconcile(map[string]Entry{"a": {Config: "a1"}, "b": {Config: "b1"}, "c": {Config: "inactive"}})
+	if len(r.running) != 2 {
+		t.Errorf("expected 2 running controllers, got %d", len(r.running))
+	}
+	runningA, runningB := r.running["a"], r.running["b"]
+
+	r.Reconcile(map[string]Entry{"a": {Config: "a1"}, "b": {Config: "b2"}, "d": {Config: "d1"}})
+	if built["a1"] != 1 {
+		t.Errorf("expected unchanged controller to keep running, built %d times", built["a1"])
+	}
+	if r.running["a"] != runningA {
+		t.Error("expected unchanged controller to be kept")
+	}
+	select {
+	case <-runningB.done:
+	case <-time.After(time.Second):
+		t.Error("expected changed controller to be stopped")
+	}
+	if built["b2"] != 1 || built["d1"] != 1 {
+		t.Errorf("expected changed and new controllers to be built once, got %v", built)
+	}
+	if len(r.running) != 3 {
+		t.Errorf("expected 3 running controllers, got %d", len(r.running))
+	}
+
+	r.Stop()
+	select {
+	case <-runningA.done:
+	default:
+		t.Error("expected controllers to be stopped")
+	}
+	if len(r.running) != 0 {
+		t.Errorf("expected no running controllers, got %d", len(r.running))
+	}
+}
+
+func TestReconcileIsolatesFailures(t *testing.T) {
+	r := NewReconciler(context.Background())
+	r.backoff = time.Millisecond
+	defer r.Stop()
+	colector := &failingColector{}
+	built := 0
+	r.build = func(entry Entry) (*Controller, error) {
+		built++
+		if entry.Config == "invalid" {
+			return nil, errors.New("invalid controller type")
+		}
+		return &Controller{interval: time.Millisecond, colector: colector, gError: &fakeGauge{}}, nil
+	}
+
+	entries := map[string]Entry{"failing": {Config: "failing"}, "typo": {Config: "invalid"}}
+	r.Reconcile(entries)
+	if _, found := r.running["failing"]; !found {
+		t.Fatal("expected valid entry to run besides an invalid one")
+	}
+	if _, found := r.invalid["typo"]; !found {
+		t.Error("expected invalid entry to be skipped")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&colector.calls) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if calls := atomic.LoadInt32(&colector.calls); calls < 3 {
+		t.Errorf("expected failing controller to be restarted, got %d executions", calls)
+	}
+
+	r.Reconcile(entries)
+	if built != 2 {
+		t.Errorf("expected unchanged entries not to be rebuilt, got %d builds", built)
+	}
+}
+
+func TestReconcileDoesNotWaitForHungControllers(t *testing.T) {
+	r := NewReconciler(context.Background())
+	defer r.Stop()
+	hung := &hungColector{started: make(chan struct{}, 1), release: make(chan struct{})}
+	r.build = func(entry Entry) (*Controller, error) {
+		return &Controller{interval: time.Millisecond, colector: hung, gError: &fakeGauge{}}, nil
+	}
+
+	r.Reconcile(map[string]Entry{"a": {Config: "a1"}})
+	<-hung.started
+	previous := r.running["a"]
+
+	reconciled := make(chan struct{})
+	go func() {
+		r.Reconcile(map[string]Entry{"a": {Config: "a2"}})
+		close(reconciled)
+	}()
+	select {
+	case <-reconciled:
+	case <-time.After(time.Second):
+		t.Fatal("expected Reconcile not to wait for a hung controller")
+	}
+
+	close(hung.release)
+	select {
+	case <-previous.done:
+	case <-time.After(time.Second):
+		t.Error("expected hung controller to be stopped")
+	}
+}
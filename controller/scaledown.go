@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/luizalabs/mitose/k8s"
+)
+
+// scaleDownProbeTimeout bounds the probes of all the pods of a scale down.
+const scaleDownProbeTimeout = 5 * time.Second
+
+// ScaleDownProbe asks each pod of a deployment how many messages it is
+// processing, the body of a GET on port and path must be that number.
+type ScaleDownProbe struct {
+	port   int
+	path   string
+	client *http.Client
+}
+
+func (p *ScaleDownProbe) InFlight(ctx context.Context, podIP string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("http://%s:%d%s", podIP, p.port, p.path), nil)
+	if err != nil {
+		return -1, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return -1, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return -1, fmt.Errorf("probe returned status %d", resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return -1, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(body)))
+}
+
+// probe asks every pod at once, the pods that can't be probed are -1.
+func (p *ScaleDownProbe) probe(ctx context.Context, t k8s.Target, pods []corev1.Pod) []int {
+	ctx, cancel := context.WithTimeout(ctx, scaleDownProbeTimeout)
+	defer cancel()
+
+	inFlight := make([]int, len(pods))
+	wg := new(sync.WaitGroup)
+	for i := range pods {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			n, err := p.InFlight(ctx, pods[i].Status.PodIP)
+			if err != nil {
+				log.Printf("error probing pod %s of %s: %s\n", pods[i].Name, t, err)
+				n = -1
+			}
+			inFlight[i] = n
+		}(i)
+	}
+	wg.Wait()
+	return inFlight
+}
+
+// rankPods sets the deletion cost of each pod to its in-flight messages
+// before a scale down, so the ReplicaSet removes the idle pods first.
+// Pods that can't be probed keep their cost.
+func (c *Controller) rankPods(ctx context.Context, desiredReplicas int) error {
+	currentReplicas, err := k8s.GetReplicasCount(ctx, c.target)
+	if err != nil {
+		return err
+	}
+	if desiredReplicas >= currentReplicas {
+		return nil
+	}
+
+	pods, err := k8s.ListDeploymentPods(ctx, c.target)
+	if err != nil {
+		return err
+	}
+	for i, inFlight := range c.scaleDownProbe.probe(ctx, c.target, pods) {
+		if inFlight < 0 {
+			continue
+		}
+		if err := k8s.SetPodDeletionCost(ctx, c.target, pods[i], inFlight); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func NewScaleDownProbe(port int, path string) *ScaleDownProbe {
+	if path == "" {
+		path = "/"
+	}
+	return &ScaleDownProbe{
+		port:   port,
+		path:   path,
+		client: new(http.Client),
+	}
+}
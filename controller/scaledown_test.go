@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/luizalabs/mitose/k8s"
+)
+
+func TestScaleDownProbe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/inflight":
+			fmt.Fprintln(w, "3")
+		case "/invalid":
+			fmt.Fprintln(w, "busy")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal("error parsing server url", err)
+	}
+	port, err := strconv.Atoi(serverURL.Port())
+	if err != nil {
+		t.Fatal("error parsing server port", err)
+	}
+
+	inFlight, err := NewScaleDownProbe(port, "/inflight").InFlight(context.Background(), serverURL.Hostname())
+	if err != nil {
+		t.Fatal("error probing", err)
+	}
+	if inFlight != 3 {
+		t.Errorf("expected 3, got %d", inFlight)
+	}
+
+	for _, path := range []string{"/invalid", "/missing"} {
+		if _, err := NewScaleDownProbe(port, path).InFlight(context.Background(), serverURL.Hostname()); err == nil {
+			t.Errorf("%s: expected error", path)
+		}
+	}
+}
+
+func TestRankPods(t *testing.T) {
+	replicas := int32(3)
+	fakeDeploy := &appsv1.Deployment{
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "worker"}},
+		},
+	}
+	fakeDeploy.Namespace = "rankNS"
+	fakeDeploy.Name = "worker"
+	objects := []runtime.Object{fakeDeploy}
+	podIPs := map[string]string{"worker-busy": "10.0.0.1", "worker-idle": "10.0.0.2", "worker-down": "10.0.0.3"}
+	for name, ip := range podIPs {
+		pod := &corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodRunning, PodIP: ip}}
+		pod.Namespace = fakeDeploy.Namespace
+		pod.Name = name
+		pod.Labels = map[string]string{"app": "worker"}
+		objects = append(objects, pod)
+	}
+	fakeK8sClient := fake.NewSimpleClientset(objects...)
+	fakeK8sClient.Resources = []*metav1.APIResourceList{{GroupVersion: "apps/v1"}}
+	clientBuilder := k8s.ClientBuilder
+	k8s.ClientBuilder = func(string) (kubernetes.Interface, error) { return fakeK8sClient, nil }
+	defer func() { k8s.ClientBuilder = clientBuilder }()
+
+	// every pod is served by the same server, which answers by pod IP
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Host {
+		case "10.0.0.1:8080":
+			fmt.Fprintln(w, "7")
+		case "10.0.0.2:8080":
+			fmt.Fprintln(w, "0")
+		default:
+			http.Error(w, "down", http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	probe := NewScaleDownProbe(8080, "/inflight")
+	probe.client.Transport = &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return new(net.Dialer).DialContext(ctx, network, server.Listener.Addr().String())
+		},
+	}
+
+	c := &Controller{target: k8s.Target{Namespace: fakeDeploy.Namespace, Name: fakeDeploy.Name}, scaleDownProbe: probe}
+	if err := c.rankPods(context.Background(), 2); err != nil {
+		t.Fatal("error ranking pods", err)
+	}
+
+	expected := map[string]string{"worker-busy": "7", "worker-idle": "0", "worker-down": ""}
+	for name, cost := range expected {
+		pod, err := fakeK8sClient.CoreV1().Pods(fakeDeploy.Namespace).Get(context.Background(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal("error getting fake pod", err)
+		}
+		if actual := pod.Annotations[k8s.PodDeletionCostAnnotation]; actual != cost {
+			t.Errorf("%s: expected cost %q, got %q", name, cost, actual)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/luizalabs/mitose/gauge"
+	"github.com/luizalabs/mitose/k8s"
+)
+
+// ScaleToZeroCruncher scales the target to zero replicas after its queues
+// stay empty for the idle period and wakes it up when the backlog reaches the
+// activation threshold, delegating to the wrapped cruncher while awake.
+// A wrapped cruncher with a varyingMin is only scaled to zero while its
+// min is zero.
+type ScaleToZeroCruncher struct {
+	cruncher            Cruncher
+	target              k8s.Target
+	activationThreshold int
+	idlePeriod          time.Duration
+	initialReplicas     int
+	idleSince           time.Time
+	now                 func() time.Time
+	gMetrics            gauge.Gauge
+}
+
+func (s *ScaleToZeroCruncher) CalcDesiredReplicas(ctx context.Context, m Metrics) (int, error) {
+	desiredReplicas, err := s.calcReplicas(ctx, m)
+	if err != nil {
+		return -1, err
+	}
+	s.gMetrics.Set(float64(desiredReplicas))
+	return desiredReplicas, nil
+}
+
+// varyingMin is implemented by the crunchers whose min changes over time.
+type varyingMin interface {
+	minimum() int
+}
+
+func (s *ScaleToZeroCruncher) calcReplicas(ctx context.Context, m Metrics) (int, error) {
+	msgsInQueue, err := strconv.Atoi(m[msgsInQueueMetricName])
+	if err != nil {
+		return -1, err
+	}
+	if v, ok := s.cruncher.(varyingMin); ok && v.minimum() > 0 {
+		if msgsInQueue > 0 {
+			s.idleSince = time.Time{}
+		}
+		return s.cruncher.CalcDesiredReplicas(ctx, m)
+	}
+	currentReplicas, err := k8s.GetTargetReplicasCount(ctx, s.target)
+	if err != nil {
+		return -1, err
+	}
+
+	if msgsInQueue > 0 {
+		s.idleSince = time.Time{}
+	}
+
+	if currentReplicas == 0 {
+		if msgsInQueue == 0 || msgsInQueue < s.activationThreshold {
+			return 0, nil
+		}
+		log.Printf("waking up %s\n", s.target)
+		desiredReplicas, err := s.cruncher.CalcDesiredReplicas(ctx, m)
+		if err != nil {
+			return -1, err
+		}
+		if desiredReplicas < s.initialReplicas {
+			return s.initialReplicas, nil
+		}
+		return desiredReplicas, nil
+	}
+
+	if msgsInQueue == 0 {
+		now := s.now()
+		if s.idleSince.IsZero() {
+			s.idleSince = now
+		}
+		if now.Sub(s.idleSince) >= s.idlePeriod {
+			return 0, nil
+		}
+	}
+	return s.cruncher.CalcDesiredReplicas(ctx, m)
+}
+
+// NewScaleToZeroCruncher wraps cruncher, an empty idlePeriod scales to zero
+// as soon as the queues are empty and zero activationThreshold and
+// initialReplicas mean one.
+func NewScaleToZeroCruncher(g gauge.Gauge, cruncher Cruncher, target k8s.Target, activationThreshold int, idlePeriod string, initialReplicas int) (Cruncher, error) {
+	var period time.Duration
+	if idlePeriod != "" {
+		var err error
+		if period, err = time.ParseDuration(idlePeriod); err != nil {
+			return nil, err
+		}
+	}
+	if activationThreshold < 0 || initialReplicas < 0 {
+		return nil, errors.New("activation_threshold and initial_replicas must not be negative")
+	}
+	if activationThreshold == 0 {
+		activationThreshold = 1
+	}
+	if initialReplicas == 0 {
+		initialReplicas = 1
+	}
+	return &ScaleToZeroCruncher{
+		cruncher:            cruncher,
+		target:              target,
+		activationThreshold: activationThreshold,
+		idlePeriod:          period,
+		initialReplicas:     initialReplicas,
+		now:                 time.Now,
+		gMetrics:            g,
+	}, nil
+}
@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/luizalabs/mitose/config"
+	"github.com/luizalabs/mitose/k8s"
+)
+
+func newFakeScaleToZeroCruncher(t *testing.T) *ScaleToZeroCruncher {
+	cruncher, err := NewScaleToZeroCruncher(
+		new(fakeGauge), new(fakeCruncher), fakeTarget, 5, "10m", 6,
+	)
+	if err != nil {
+		t.Fatal("error creating scale to zero cruncher", err)
+	}
+	return cruncher.(*ScaleToZeroCruncher)
+}
+
+func TestScaleToZeroCruncherWakeUp(t *testing.T) {
+	clientBuilder := k8s.ClientBuilder
+	k8s.ClientBuilder = fakeDeployBuilder("fakeNS", "fakeDeploy", 0)
+	defer func() { k8s.ClientBuilder = clientBuilder }()
+
+	var testCases = []struct {
+		msgsInQueue string
+		expected    int
+	}{
+		{"0", 0},
+		{"4", 0},
+		{"5", 6},
+		{"1", 0},
+		{"7", 7},
+	}
+
+	cruncher := newFakeScaleToZeroCruncher(t)
+	for _, tc := range testCases {
+		actual, err := cruncher.CalcDesiredReplicas(context.Background(), Metrics{msgsInQueueMetricName: tc.msgsInQueue})
+		if err != nil {
+			t.Fatal("error calculating desired replicas", err)
+		}
+		if actual != tc.expected {
+			t.Errorf("%s msgs: expected %d, got %d", tc.msgsInQueue, tc.expected, actual)
+		}
+	}
+}
+
+func TestScaleToZeroCruncherIdle(t *testing.T) {
+	clientBuilder := k8s.ClientBuilder
+	k8s.ClientBuilder = fakeDeployBuilder("fakeNS", "fakeDeploy", 2)
+	defer func() { k8s.ClientBuilder = clientBuilder }()
+
+	now := time.Now()
+	var testCases = []struct {
+		elapsed     time.Duration
+		msgsInQueue string
+		expected    int
+	}{
+		{0, "0", 1},
+		{5 * time.Minute, "0", 1},
+		{6 * time.Minute, "2", 2},
+		{7 * time.Minute, "0", 1},
+		{16 * time.Minute, "0", 1},
+		{17 * time.Minute, "0", 0},
+	}
+
+	cruncher := newFakeScaleToZeroCruncher(t)
+	cruncher.cruncher = &fakeAwakeCruncher{}
+	for _, tc := range testCases {
+		elapsed := tc.elapsed
+		cruncher.now = func() time.Time { return now.Add(elapsed) }
+		actual, err := cruncher.CalcDesiredReplicas(context.Background(), Metrics{msgsInQueueMetricName: tc.msgsInQueue})
+		if err != nil {
+			t.Fatal("error calculating desired replicas", err)
+		}
+		if actual != tc.expected {
+			t.Errorf("%s msgs after %s: expected %d, got %d", tc.msgsInQueue, tc.elapsed, tc.expected, actual)
+		}
+	}
+}
+
+type fakeAwakeCruncher struct{}
+
+func (f *fakeAwakeCruncher) CalcDesiredReplicas(ctx context.Context, m Metrics) (int, error) {
+	n, err := new(fakeCruncher).CalcDesiredReplicas(ctx, m)
+	if n < 1 {
+		return 1, err
+	}
+	return n, err
+}
+
+func TestScaleToZeroRejectsHPA(t *testing.T) {
+	for _, scaleMethod := range []string{HPAScaleMethod, ExternalScaleMethod} {
+		conf := config.Config{Namespace: "fakeNS", Deployment: "fakeDeploy", ScaleMethod: scaleMethod, Max: 5, MsgsPerPod: 10}
+		if _, err := cruncherFactory(conf); err == nil {
+			t.Errorf("expected scale_method %s to reject min 0", scaleMethod)
+		}
+		conf.Min = 1
+		if _, err := cruncherFactory(conf); err != nil {
+			t.Errorf("unexpected error with scale_method %s and min 1: %v", scaleMethod, err)
+		}
+	}
+}
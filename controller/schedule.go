@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/luizalabs/mitose/config"
+	"github.com/luizalabs/mitose/cron"
+)
+
+type cruncherBuilder func(config.Config) (Cruncher, error)
+
+type scheduledCruncher struct {
+	cron     *cron.Expression
+	duration time.Duration
+	location *time.Location
+	min      int
+	cruncher Cruncher
+}
+
+// ScheduleCruncher delegates to the cruncher of the first active schedule,
+// or to the default cruncher when none of them is active.
+type ScheduleCruncher struct {
+	namespace  string
+	deployment string
+	schedules  []scheduledCruncher
+	min        int
+	cruncher   Cruncher
+	active     int
+	now        func() time.Time
+}
+
+func (s *ScheduleCruncher) CalcDesiredReplicas(ctx context.Context, m Metrics) (int, error) {
+	active := s.activeSchedule()
+	if active != s.active {
+		if active == -1 {
+			log.Printf("schedules ended for deployment %s (namespace %s)\n", s.deployment, s.namespace)
+		} else {
+			log.Printf(
+				"schedule %q active for deployment %s (namespace %s)\n",
+				s.schedules[active].cron,
+				s.deployment,
+				s.namespace,
+			)
+		}
+		s.active = active
+	}
+	if active == -1 {
+		return s.cruncher.CalcDesiredReplicas(ctx, m)
+	}
+	return s.schedules[active].cruncher.CalcDesiredReplicas(ctx, m)
+}
+
+// minimum is the min of the active schedule, or of the default cruncher.
+func (s *ScheduleCruncher) minimum() int {
+	if active := s.activeSchedule(); active != -1 {
+		return s.schedules[active].min
+	}
+	return s.min
+}
+
+func (s *ScheduleCruncher) activeSchedule() int {
+	now := s.now()
+	for i, schedule := range s.schedules {
+		if schedule.cron.FiredWithin(now.In(schedule.location), schedule.duration) {
+			return i
+		}
+	}
+	return -1
+}
+
+// NewScheduleCruncher builds the default cruncher and one cruncher for each
+// schedule of conf, with the schedule overrides applied. When any min is zero
+// a single ScaleToZeroCruncher wraps them all, so its idle time survives the
+// schedule changes.
+func NewScheduleCruncher(conf config.Config, build cruncherBuilder) (Cruncher, error) {
+	cruncher, err := build(awake(conf))
+	if err != nil {
+		return nil, err
+	}
+	scalesToZero := conf.Min == 0
+
+	schedules := make([]scheduledCruncher, len(conf.Schedules))
+	for i, s := range conf.Schedules {
+		expression, err := cron.Parse(s.Cron)
+		if err != nil {
+			return nil, err
+		}
+		duration, err := time.ParseDuration(s.Duration)
+		if err != nil {
+			return nil, err
+		}
+		timezone := s.Timezone
+		if timezone == "" {
+			timezone = conf.Timezone
+		}
+		location, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, err
+		}
+		scheduled := s.Apply(conf)
+		scheduleCruncher, err := build(awake(scheduled))
+		if err != nil {
+			return nil, err
+		}
+		scalesToZero = scalesToZero || scheduled.Min == 0
+		schedules[i] = scheduledCruncher{
+			cron:     expression,
+			duration: duration,
+			location: location,
+			min:      scheduled.Min,
+			cruncher: scheduleCruncher,
+		}
+	}
+
+	scheduleCruncher := &ScheduleCruncher{
+		namespace:  conf.Namespace,
+		deployment: conf.Deployment,
+		schedules:  schedules,
+		min:        conf.Min,
+		cruncher:   cruncher,
+		active:     -1,
+		now:        time.Now,
+	}
+	if !scalesToZero {
+		return scheduleCruncher, nil
+	}
+	return newScaleToZeroCruncher(conf, scheduleCruncher)
+}
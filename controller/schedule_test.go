@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/luizalabs/mitose/config"
+	"github.com/luizalabs/mitose/k8s"
+)
+
+func TestScheduleCruncher(t *testing.T) {
+	blackFridayMin, blackFridayMsgsPerPod := 8, 5
+	conf := config.Config{
+		Namespace:  "fakeNS",
+		Deployment: "fakeDeploy",
+		Max:        20,
+		Min:        1,
+		MsgsPerPod: 10,
+		Timezone:   "America/Sao_Paulo",
+		Schedules: []config.Schedule{
+			{Cron: "0 0 23 11 *", Duration: "24h", Min: &blackFridayMin, MsgsPerPod: &blackFridayMsgsPerPod},
+		},
+	}
+
+	cruncher, err := NewScheduleCruncher(conf, func(c config.Config) (Cruncher, error) {
+		return NewRatioCruncher(new(fakeGauge), fakeTarget, c.Max, c.Min, c.MsgsPerPod, c.Rounding, c.Tolerance)
+	})
+	if err != nil {
+		t.Fatal("error creating schedule cruncher", err)
+	}
+
+	location, err := time.LoadLocation("America/Sao_Paulo")
+	if err != nil {
+		t.Fatal("error loading location", err)
+	}
+
+	var testCases = []struct {
+		now         time.Time
+		msgsInQueue string
+		expected    int
+	}{
+		{time.Date(2018, time.November, 22, 23, 59, 0, 0, location), "0", 1},
+		{time.Date(2018, time.November, 22, 23, 59, 0, 0, location), "50", 5},
+		{time.Date(2018, time.November, 23, 0, 0, 0, 0, location), "0", 8},
+		{time.Date(2018, time.November, 23, 18, 0, 0, 0, location), "50", 10},
+		{time.Date(2018, time.November, 24, 0, 0, 0, 0, location), "50", 5},
+	}
+
+	for _, tc := range testCases {
+		now := tc.now
+		cruncher.(*ScheduleCruncher).now = func() time.Time { return now }
+		actual, err := cruncher.CalcDesiredReplicas(context.Background(), Metrics{msgsInQueueMetricName: tc.msgsInQueue})
+		if err != nil {
+			t.Fatal("error calculating desired replicas", err)
+		}
+		if actual != tc.expected {
+			t.Errorf("%s msgs at %s: expected %d, got %d", tc.msgsInQueue, tc.now, tc.expected, actual)
+		}
+	}
+}
+
+func TestScheduleCruncherScaleToZero(t *testing.T) {
+	clientBuilder := k8s.ClientBuilder
+	k8s.ClientBuilder = fakeDeployBuilder("fakeNS", "fakeDeploy", 1)
+	defer func() { k8s.ClientBuilder = clientBuilder }()
+
+	nightMax, lunchMin := 2, 2
+	conf := config.Config{
+		Namespace:  "fakeNS",
+		Deployment: "fakeDeploy",
+		Max:        20,
+		MsgsPerPod: 10,
+		IdlePeriod: "1h",
+		Timezone:   "UTC",
+		Schedules: []config.Schedule{
+			{Cron: "0 22 * * *", Duration: "8h", Max: &nightMax},
+			{Cron: "0 12 * * *", Duration: "1h", Min: &lunchMin},
+		},
+	}
+	cruncher, err := NewScheduleCruncher(conf, newCruncher)
+	if err != nil {
+		t.Fatal("error creating schedule cruncher", err)
+	}
+	scaleToZero, ok := cruncher.(*ScaleToZeroCruncher)
+	if !ok {
+		t.Fatalf("expected a single scale to zero around the schedules, got %T", cruncher)
+	}
+	schedule := scaleToZero.cruncher.(*ScheduleCruncher)
+
+	var testCases = []struct {
+		now      time.Time
+		expected int
+	}{
+		{time.Date(2018, time.November, 22, 21, 30, 0, 0, time.UTC), 1},
+		// the night schedule starts, the idle time keeps counting
+		{time.Date(2018, time.November, 22, 22, 0, 0, 0, time.UTC), 1},
+		{time.Date(2018, time.November, 22, 22, 30, 0, 0, time.UTC), 0},
+		// the lunch schedule keeps two replicas even when idle
+		{time.Date(2018, time.November, 23, 12, 30, 0, 0, time.UTC), 2},
+	}
+
+	for _, tc := range testCases {
+		now := tc.now
+		schedule.now = func() time.Time { return now }
+		scaleToZero.now = func() time.Time { return now }
+		actual, err := cruncher.CalcDesiredReplicas(context.Background(), Metrics{msgsInQueueMetricName: "0"})
+		if err != nil {
+			t.Fatal("error calculating desired replicas", err)
+		}
+		if actual != tc.expected {
+			t.Errorf("at %s: expected %d, got %d", tc.now, tc.expected, actual)
+		}
+	}
+}
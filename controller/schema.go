@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+const schemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// fieldConstraints are the JSON Schema keywords of the fields that accept
+// only some values, checked by Validate as well.
+var fieldConstraints = map[string]map[string]interface{}{
+	"scale_method":          {"enum": scaleMethods},
+	"rounding":              {"enum": roundings},
+	"aggregation":           {"enum": aggregations},
+	"min":                   {"minimum": 0},
+	"max":                   {"minimum": 1},
+	"msgs_per_pod":          {"minimum": 1},
+	"tolerance":             {"minimum": 0, "exclusiveMaximum": 1},
+	"activation_threshold":  {"minimum": 0},
+	"initial_replicas":      {"minimum": 0},
+	"scale_down_probe_port": {"minimum": 0, "maximum": 65535},
+	"queue_urls":            {"minItems": 1},
+	"subscription_ids":      {"minItems": 1},
+	"collectors":            {"minItems": 1},
+}
+
+var requiredFields = []string{"namespace", "deployment", "type", "interval"}
+
+// Schema returns the JSON Schema of a controller config, so editors and CI
+// can check configs before they reach the cluster.
+func Schema() ([]byte, error) {
+	types := controllerTypes()
+	variants := make([]interface{}, 0, len(types))
+	colectorVariants := make([]interface{}, 0, len(types))
+	for _, t := range types {
+		variants = append(variants, typeSchema(t, controllerConfigs[t], requiredFields))
+		if t != "composite" {
+			colectorSchema := typeSchema(t, controllerConfigs[t], []string{"type"})
+			for _, field := range controllerFields {
+				delete(colectorSchema["properties"].(map[string]interface{}), field)
+			}
+			colectorVariants = append(colectorVariants, colectorSchema)
+		}
+	}
+	schema := map[string]interface{}{
+		"$schema":     schemaDraft,
+		"title":       "mitose controller config",
+		"oneOf":       variants,
+		"definitions": map[string]interface{}{"collector": map[string]interface{}{"oneOf": colectorVariants}},
+	}
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+func typeSchema(name string, t reflect.Type, required []string) map[string]interface{} {
+	properties := make(map[string]interface{})
+	for field, ft := range jsonFields(t) {
+		p := valueSchema(ft)
+		for k, v := range fieldConstraints[field] {
+			p[k] = v
+		}
+		properties[field] = p
+	}
+	properties["type"] = map[string]interface{}{"const": name}
+	if _, found := properties["collectors"]; found {
+		properties["collectors"].(map[string]interface{})["items"] = map[string]interface{}{"$ref": "#/definitions/collector"}
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+func valueSchema(t reflect.Type) map[string]interface{} {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		if t == reflect.TypeOf(json.RawMessage{}) {
+			return map[string]interface{}{}
+		}
+		return map[string]interface{}{"type": "array", "items": valueSchema(t.Elem())}
+	case reflect.Struct:
+		fields := jsonFields(t)
+		properties := make(map[string]interface{}, len(fields))
+		for name, ft := range fields {
+			properties[name] = valueSchema(ft)
+		}
+		return map[string]interface{}{"type": "object", "properties": properties, "additionalProperties": false}
+	}
+	return map[string]interface{}{}
+}
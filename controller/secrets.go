@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/luizalabs/mitose/config"
+	"github.com/luizalabs/mitose/k8s"
+)
+
+const secretRefSuffix = "_secret_ref"
+
+// secretValue returns the value of ref when it is set, otherwise plain.
+func secretValue(conf config.Config, ref *config.SecretRef, plain string) (string, error) {
+	if ref == nil {
+		return plain, nil
+	}
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = conf.Namespace
+	}
+	value, _, err := k8s.GetSecretValue(namespace, ref.Name, ref.Key)
+	return value, err
+}
+
+// secretRefs returns every *_secret_ref of confJSON, including the ones of
+// composite collectors, with the default namespace filled.
+func secretRefs(confJSON string) ([]config.SecretRef, error) {
+	var conf interface{}
+	if err := json.Unmarshal([]byte(confJSON), &conf); err != nil {
+		return nil, err
+	}
+	namespace := ""
+	if m, ok := conf.(map[string]interface{}); ok {
+		namespace, _ = m["namespace"].(string)
+	}
+
+	refs := make([]config.SecretRef, 0)
+	var walk func(v interface{}) error
+	walk = func(v interface{}) error {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for field, value := range v {
+				if !strings.HasSuffix(field, secretRefSuffix) {
+					if err := walk(value); err != nil {
+						return err
+					}
+					continue
+				}
+				raw, err := json.Marshal(value)
+				if err != nil {
+					return err
+				}
+				ref := config.SecretRef{}
+				if err := json.Unmarshal(raw, &ref); err != nil {
+					return fmt.Errorf("%s: %s", field, err)
+				}
+				if ref.Namespace == "" {
+					ref.Namespace = namespace
+				}
+				refs = append(refs, ref)
+			}
+		case []interface{}:
+			for _, value := range v {
+				if err := walk(value); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(conf); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// secretsVersion identifies the current version of the secrets referenced by
+// confJSON, so controllers are rebuilt when one of them changes.
+func secretsVersion(confJSON string) string {
+	refs, err := secretRefs(confJSON)
+	if err != nil {
+		return err.Error()
+	}
+	versions := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		_, version, err := k8s.GetSecretValue(ref.Namespace, ref.Name, ref.Key)
+		if err != nil {
+			version = err.Error()
+		}
+		versions = append(versions, fmt.Sprintf("%s/%s/%s=%s", ref.Namespace, ref.Name, ref.Key, version))
+	}
+	sort.Strings(versions)
+	return strings.Join(versions, ",")
+}
+
+// stopUnusedSecrets stops watching the secrets no entry references.
+func stopUnusedSecrets(entries map[string]Entry) {
+	used := make(map[config.SecretRef]bool)
+	for _, entry := range entries {
+		refs, _ := secretRefs(entry.Config)
+		for _, ref := range refs {
+			used[config.SecretRef{Namespace: ref.Namespace, Name: ref.Name}] = true
+		}
+	}
+	k8s.StopUnusedSecretInformers(func(namespace, name string) bool {
+		return used[config.SecretRef{Namespace: namespace, Name: name}]
+	})
+}
+
+// checkSecretNamespaces rejects secrets of other namespaces, so a
+// MitoseAutoscaler can't read what its owner isn't allowed to.
+func checkSecretNamespaces(confJSON, namespace string) error {
+	refs, err := secretRefs(confJSON)
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if ref.Namespace != namespace {
+			return fmt.Errorf("secret %s/%s is not on namespace %s", ref.Namespace, ref.Name, namespace)
+		}
+	}
+	return nil
+}
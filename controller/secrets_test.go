@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/luizalabs/mitose/config"
+	"github.com/luizalabs/mitose/k8s"
+)
+
+func TestSecretRefs(t *testing.T) {
+	confJSON := `{
+		"namespace": "fakeNS",
+		"type": "composite",
+		"collectors": [
+			{"type": "sqs", "key_secret_ref": {"name": "aws", "key": "key"}},
+			{"type": "rabbitmq", "credentials_secret_ref": {"name": "rabbit", "namespace": "otherNS", "key": "credentials"}}
+		]
+	}`
+	refs, err := secretRefs(confJSON)
+	if err != nil {
+		t.Fatal("error reading secret refs", err)
+	}
+	expected := map[config.SecretRef]bool{
+		{Name: "aws", Namespace: "fakeNS", Key: "key"}:             true,
+		{Name: "rabbit", Namespace: "otherNS", Key: "credentials"}: true,
+	}
+	if len(refs) != len(expected) {
+		t.Fatalf("expected %d refs, got %v", len(expected), refs)
+	}
+	for _, ref := range refs {
+		if !expected[ref] {
+			t.Errorf("unexpected ref %+v", ref)
+		}
+	}
+
+	if err := checkSecretNamespaces(confJSON, "fakeNS"); err == nil {
+		t.Error("expected error for a secret of another namespace")
+	}
+	if err := checkSecretNamespaces(`{"namespace": "fakeNS", "key_secret_ref": {"name": "aws"}}`, "fakeNS"); err != nil {
+		t.Error("unexpected error for a secret of the same namespace", err)
+	}
+}
+
+func TestSecretValue(t *testing.T) {
+	secret := &corev1.Secret{Data: map[string][]byte{"credentials": []byte("dXNlcjpwYXNz")}}
+	secret.Name = "rabbit"
+	secret.Namespace = "fakeNS"
+	fakeK8sClient := fake.NewSimpleClientset(secret)
+
+	clientBuilder := k8s.ClientBuilder
+	k8s.ClientBuilder = func(string) (kubernetes.Interface, error) { return fakeK8sClient, nil }
+	defer func() { k8s.ClientBuilder = clientBuilder }()
+
+	conf := config.Config{Namespace: "fakeNS"}
+	if value, _ := secretValue(conf, nil, "plain"); value != "plain" {
+		t.Errorf("expected plain value without ref, got %s", value)
+	}
+	value, err := secretValue(conf, &config.SecretRef{Name: "rabbit", Key: "credentials"}, "plain")
+	if err != nil {
+		t.Fatal("error getting secret value", err)
+	}
+	if value != "dXNlcjpwYXNz" {
+		t.Errorf("expected value of secret, got %s", value)
+	}
+}
@@ -1,8 +1,8 @@
 package controller
 
 import (
+	"context"
 	"encoding/json"
-	"math"
 	"strconv"
 
 	"github.com/luizalabs/mitose/aws"
@@ -12,11 +12,14 @@ import (
 
 type SQSControlerConfig struct {
 	config.Config
-	Key        string   `json:"key"`
-	Secret     string   `json:"secret"`
-	Region     string   `json:"region"`
-	QueueURLs  []string `json:"queue_urls"`
-	MsgsPerPod int      `json:"msgs_per_pod"`
+	Key             string            `json:"key"`
+	KeySecretRef    *config.SecretRef `json:"key_secret_ref"`
+	Secret          string            `json:"secret"`
+	SecretSecretRef *config.SecretRef `json:"secret_secret_ref"`
+	Region          string            `json:"region"`
+	RoleARN         string            `json:"role_arn"`
+	ExternalID      string            `json:"external_id"`
+	QueueURLs       []string          `json:"queue_urls"`
 }
 
 type SQSColector struct {
@@ -25,97 +28,70 @@ type SQSColector struct {
 	gMetrics  gauge.Gauge
 }
 
-type SQSCruncher struct {
-	max        int
-	min        int
-	msgsPerPod int
-	gMetrics   gauge.Gauge
-}
-
-func (s *SQSColector) GetMetrics() (Metrics, error) {
-	msgsInQueue := 0
+func (s *SQSColector) GetMetrics(ctx context.Context) (Metrics, error) {
+	msgsVisible, msgsInFlight := 0, 0
 	for _, queueURL := range s.queueURLs {
-		n, err := s.getNumberOfMsgsInQueue(queueURL)
+		visible, inFlight, err := s.getNumberOfMsgsInQueue(ctx, queueURL)
 		if err != nil {
 			return nil, err
 		}
-		msgsInQueue += n
+		msgsVisible += visible
+		msgsInFlight += inFlight
 	}
+	msgsInQueue := msgsVisible + msgsInFlight
 	s.gMetrics.Set(float64(msgsInQueue))
-	return Metrics{msgsInQueueMetricName: strconv.Itoa(msgsInQueue)}, nil
+	return Metrics{
+		msgsInQueueMetricName:  strconv.Itoa(msgsInQueue),
+		msgsVisibleMetricName:  strconv.Itoa(msgsVisible),
+		msgsInFlightMetricName: strconv.Itoa(msgsInFlight),
+	}, nil
 }
 
-func (s *SQSColector) getNumberOfMsgsInQueue(queueURL string) (int, error) {
+func (s *SQSColector) getNumberOfMsgsInQueue(ctx context.Context, queueURL string) (int, int, error) {
 	attrs, err := s.cli.GetQueueAttributes(
+		ctx,
 		queueURL,
 		numberOfMessagesInQueueAttrName,
 		numberOfMessagesInFlightQueueAttrName,
 	)
 	if err != nil {
-		return -1, err
+		return -1, -1, err
 	}
 	visible, err := strconv.Atoi(attrs[numberOfMessagesInQueueAttrName])
 	if err != nil {
-		return -1, err
+		return -1, -1, err
 	}
 	inFlight, err := strconv.Atoi(attrs[numberOfMessagesInFlightQueueAttrName])
 	if err != nil {
-		return -1, err
-	}
-	return visible + inFlight, nil
-}
-
-func (s *SQSCruncher) CalcDesiredReplicas(m Metrics) (int, error) {
-	desiredReplicas, err := s.calcReplicas(m)
-	if err != nil {
-		return -1, err
+		return -1, -1, err
 	}
-	s.gMetrics.Set(float64(desiredReplicas))
-	return desiredReplicas, nil
+	return visible, inFlight, nil
 }
 
-func (s *SQSCruncher) calcReplicas(m Metrics) (int, error) {
-	msgsInQueue, err := strconv.Atoi(m[msgsInQueueMetricName])
-	if err != nil {
-		return -1, err
-	}
-	desiredReplicas := float64(msgsInQueue) / float64(s.msgsPerPod)
-	if desiredReplicas > float64(s.max) {
-		return s.max, nil
-	} else if desiredReplicas < float64(s.min) {
-		return s.min, nil
-	}
-	desiredReplicas = math.Ceil(desiredReplicas)
-	return int(desiredReplicas), nil
-}
-
-func NewSQSColector(g gauge.Gauge, awsKey, awsSecret, awsRegion string, queueURLs ...string) Colector {
-	cli := aws.NewSQSClient(awsKey, awsSecret, awsRegion)
+func NewSQSColector(g gauge.Gauge, awsKey, awsSecret, awsRegion, roleARN, externalID string, queueURLs ...string) Colector {
+	cli := aws.NewSQSClient(awsKey, awsSecret, awsRegion, roleARN, externalID)
 	return &SQSColector{queueURLs: queueURLs, cli: cli, gMetrics: g}
 }
 
-func NewSQSCruncher(g gauge.Gauge, max, min, msgsPerPod int) Cruncher {
-	return &SQSCruncher{max: max, min: min, msgsPerPod: msgsPerPod, gMetrics: g}
-}
-
-func NewSQSController(confJSON string) (*Controller, error) {
-	conf := new(SQSControlerConfig)
+func buildSQSColector(base config.Config, confJSON, metricSuffix string) (Colector, error) {
+	conf := &SQSControlerConfig{Config: base}
 	if err := json.Unmarshal([]byte(confJSON), conf); err != nil {
 		return nil, err
 	}
 
-	gColector := gauge.NewPrometheusGauge(conf.Namespace, conf.Deployment, "SQS")
-	colector := NewSQSColector(gColector, conf.Key, conf.Secret, conf.Region, conf.QueueURLs...)
+	key, err := secretValue(base, conf.KeySecretRef, conf.Key)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := secretValue(base, conf.SecretSecretRef, conf.Secret)
+	if err != nil {
+		return nil, err
+	}
 
-	gCruncher := gauge.NewPrometheusGauge(conf.Namespace, conf.Deployment, "CRUNCHER")
-	cruncher := NewSQSCruncher(gCruncher, conf.Max, conf.Min, conf.MsgsPerPod)
+	gColector := gauge.NewPrometheusGauge(conf.Namespace, conf.Deployment, "SQS"+metricSuffix)
+	return NewSQSColector(gColector, key, secret, conf.Region, conf.RoleARN, conf.ExternalID, conf.QueueURLs...), nil
+}
 
-	return NewController(
-		colector,
-		cruncher,
-		conf.Namespace,
-		conf.Deployment,
-		conf.ScaleMethod,
-		conf.Interval,
-	)
+func NewSQSController(confJSON string) (*Controller, error) {
+	return buildController(confJSON, buildSQSColector)
 }
@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/luizalabs/mitose/k8s"
+)
+
+// autoscalerRef is the MitoseAutoscaler of a controller built from one.
+type autoscalerRef struct {
+	namespace    string
+	name         string
+	generation   int64
+	lastReplicas *int
+}
+
+// ReportTo makes c report each execution on the status of the
+// MitoseAutoscaler a.
+func (c *Controller) ReportTo(a k8s.Autoscaler) {
+	c.autoscaler = &autoscalerRef{namespace: a.Namespace, name: a.Name, generation: a.Generation}
+}
+
+// reportStatus records the result of an execution on the MitoseAutoscaler,
+// a failure to do so is only logged.
+func (c *Controller) reportStatus(ctx context.Context, m Metrics, desiredReplicas int, execErr error) {
+	status := k8s.AutoscalerStatus{
+		ObservedGeneration: c.autoscaler.generation,
+		Metrics:            m,
+		DesiredReplicas:    desiredReplicas,
+	}
+	if execErr != nil {
+		status.Error = execErr.Error()
+	}
+	if c.scaleMethod != HPAScaleMethod && c.scaleMethod != ExternalScaleMethod {
+		current, err := k8s.GetTargetReplicasCount(ctx, c.target)
+		if err != nil {
+			log.Printf("error reading replicas of %s: %s\n", c.target, err)
+		} else {
+			status.CurrentReplicas = &current
+			last := c.autoscaler.lastReplicas
+			if last != nil && *last != current {
+				now := metav1.NewTime(time.Now())
+				status.LastScaleTime = &now
+			}
+			c.autoscaler.lastReplicas = &current
+		}
+	}
+
+	if err := k8s.UpdateAutoscalerStatus(ctx, c.autoscaler.namespace, c.autoscaler.name, status); err != nil {
+		log.Printf("error updating status of %s %s/%s: %s\n", k8s.AutoscalerKind, c.autoscaler.namespace, c.autoscaler.name, err)
+	}
+}
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	"github.com/luizalabs/mitose/k8s"
+)
+
+func TestReportStatus(t *testing.T) {
+	autoscaler := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	autoscaler.SetAPIVersion(k8s.AutoscalerGroup + "/" + k8s.AutoscalerVersion)
+	autoscaler.SetKind(k8s.AutoscalerKind)
+	autoscaler.SetNamespace("fakeNS")
+	autoscaler.SetName("fakeAutoscaler")
+	dc := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{k8s.AutoscalerResource: k8s.AutoscalerKind + "List"},
+		autoscaler,
+	)
+
+	dynamicClientBuilder, clientBuilder := k8s.DynamicClientBuilder, k8s.ClientBuilder
+	k8s.DynamicClientBuilder = func(string) (dynamic.Interface, error) { return dc, nil }
+	k8s.ClientBuilder = fakeDeployBuilder("fakeNS", "fakeDeploy", 10)
+	defer func() { k8s.DynamicClientBuilder, k8s.ClientBuilder = dynamicClientBuilder, clientBuilder }()
+
+	c := &Controller{target: fakeTarget}
+	c.ReportTo(k8s.Autoscaler{Namespace: "fakeNS", Name: "fakeAutoscaler", Generation: 3})
+
+	getStatus := func() map[string]interface{} {
+		u, err := dc.Resource(k8s.AutoscalerResource).Namespace("fakeNS").Get(context.Background(), "fakeAutoscaler", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal("error getting autoscaler", err)
+		}
+		status, _, _ := unstructured.NestedMap(u.Object, "status")
+		return status
+	}
+
+	c.reportStatus(context.Background(), Metrics{"msgsInQueue": "42"}, 5, errors.New("fake error"))
+	status := getStatus()
+	if status["currentReplicas"] != int64(10) || status["desiredReplicas"] != int64(5) || status["observedGeneration"] != int64(3) {
+		t.Errorf("unexpected status %v", status)
+	}
+	if status["error"] != "fake error" {
+		t.Errorf("expected fake error on status, got %v", status["error"])
+	}
+	if _, found := status["lastScaleTime"]; found {
+		t.Error("expected no lastScaleTime on first report")
+	}
+
+	lastReplicas := 7
+	c.autoscaler.lastReplicas = &lastReplicas
+	c.reportStatus(context.Background(), Metrics{"msgsInQueue": "42"}, 10, nil)
+	status = getStatus()
+	if status["error"] != "" {
+		t.Errorf("expected error to be cleared, got %v", status["error"])
+	}
+	if _, found := status["lastScaleTime"]; !found {
+		t.Error("expected lastScaleTime after replicas change")
+	}
+}
+
+// slowColector answers once ctx is done, like a broker that doesn't.
+type slowColector struct{}
+
+func (slowColector) GetMetrics(ctx context.Context) (Metrics, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestReportStatusAfterTimeout(t *testing.T) {
+	autoscaler := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	autoscaler.SetAPIVersion(k8s.AutoscalerGroup + "/" + k8s.AutoscalerVersion)
+	autoscaler.SetKind(k8s.AutoscalerKind)
+	autoscaler.SetNamespace("fakeNS")
+	autoscaler.SetName("fakeAutoscaler")
+	dc := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{k8s.AutoscalerResource: k8s.AutoscalerKind + "List"},
+		autoscaler,
+	)
+
+	dynamicClientBuilder, clientBuilder := k8s.DynamicClientBuilder, k8s.ClientBuilder
+	k8s.DynamicClientBuilder = func(string) (dynamic.Interface, error) { return dc, nil }
+	k8s.ClientBuilder = fakeDeployBuilder("fakeNS", "fakeDeploy", 10)
+	defer func() { k8s.DynamicClientBuilder, k8s.ClientBuilder = dynamicClientBuilder, clientBuilder }()
+
+	c := &Controller{target: fakeTarget, colector: slowColector{}, interval: time.Millisecond, gError: &fakeGauge{}}
+	c.ReportTo(k8s.Autoscaler{Namespace: "fakeNS", Name: "fakeAutoscaler"})
+	if err := c.Exec(context.Background()); err != context.DeadlineExceeded {
+		t.Fatalf("expected the execution to time out, got %v", err)
+	}
+
+	u, err := dc.Resource(k8s.AutoscalerResource).Namespace("fakeNS").Get(context.Background(), "fakeAutoscaler", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal("error getting autoscaler", err)
+	}
+	status, _, _ := unstructured.NestedMap(u.Object, "status")
+	if status["error"] != context.DeadlineExceeded.Error() {
+		t.Errorf("expected the timeout on status, got %v", status["error"])
+	}
+}
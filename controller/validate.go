@@ -0,0 +1,348 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/luizalabs/mitose/config"
+	"github.com/luizalabs/mitose/cron"
+	"github.com/luizalabs/mitose/expression"
+	"github.com/luizalabs/mitose/k8s"
+)
+
+// ValidationError lists every problem found on a config.
+type ValidationError struct {
+	Errors []string
+}
+
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Errors, "; ")
+}
+
+// controllerConfigs are the config of each controller type, their json
+// fields are the only ones accepted.
+var controllerConfigs = map[string]reflect.Type{
+	"sqs":       reflect.TypeOf(SQSControlerConfig{}),
+	"pubsub":    reflect.TypeOf(PubSubControlerConfig{}),
+	"rabbitmq":  reflect.TypeOf(RabbitMQControlerConfig{}),
+	"composite": reflect.TypeOf(CompositeControlerConfig{}),
+}
+
+var (
+	scaleMethods = []string{"", DeployScaleMethod, HPAScaleMethod, JobScaleMethod, ExternalScaleMethod}
+	roundings    = []string{"", CeilRounding, FloorRounding, RoundRounding}
+	aggregations = []string{"", MaxAggregation, MinAggregation, AvgAggregation, SumAggregation}
+
+	// controllerFields belong to the controller as a whole, collectors of a
+	// composite only use their type, bounds and crunching fields
+	controllerFields = []string{
+		"cluster", "namespace", "deployment", "target_kind", "target_api_version",
+		"scale_method", "interval", "active", "schedules",
+		"activation_threshold", "idle_period", "initial_replicas",
+		"scale_down_probe_port", "scale_down_probe_path",
+	}
+)
+
+type validator struct {
+	errors []string
+}
+
+func (v *validator) add(prefix, format string, args ...interface{}) {
+	v.errors = append(v.errors, prefix+fmt.Sprintf(format, args...))
+}
+
+// Validate checks confJSON strictly, so a typo doesn't silently become a zero
+// value, and reports every problem at once.
+func Validate(confJSON string) error {
+	v := new(validator)
+	v.validate(confJSON)
+	if len(v.errors) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: v.errors}
+}
+
+func (v *validator) validate(confJSON string) {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal([]byte(confJSON), &fields); err != nil {
+		v.add("", "%s", err)
+		return
+	}
+	// the other fields are still decoded after a type error, which is
+	// reported by checkFields
+	conf := config.Config{}
+	err := json.Unmarshal([]byte(confJSON), &conf)
+	if _, isTypeError := err.(*json.UnmarshalTypeError); err != nil && !isTypeError {
+		v.add("", "%s", err)
+		return
+	}
+
+	confType, found := controllerConfigs[conf.Type]
+	if !found {
+		v.add("", "type: unknown %q, expected one of %s", conf.Type, strings.Join(controllerTypes(), ", "))
+		if err != nil {
+			v.add("", "%s", err)
+		}
+		return
+	}
+	v.checkFields("", confType, fields, confJSON)
+	v.checkBase(conf)
+	v.checkSecretRefs(confJSON)
+
+	if conf.Type != "composite" {
+		v.checkColector("", conf.Type, confJSON, conf)
+		return
+	}
+	composite := CompositeControlerConfig{}
+	json.Unmarshal([]byte(confJSON), &composite)
+	if !contains(aggregations, composite.Aggregation) {
+		v.add("", "aggregation: unknown %q", composite.Aggregation)
+	}
+	if len(composite.Colectors) == 0 {
+		v.add("", "collectors: at least one collector is required")
+	}
+	// collectors inherit the fields of the composite, but its expression and
+	// schedules apply to the aggregated result only
+	base := composite.Config
+	base.Schedules = nil
+	for i, raw := range composite.Colectors {
+		prefix := fmt.Sprintf("collectors[%d].", i)
+		colectorConf := base
+		if err := json.Unmarshal(raw, &colectorConf); err != nil {
+			v.add(prefix, "%s", err)
+			continue
+		}
+		colectorType, found := controllerConfigs[colectorConf.Type]
+		if !found || colectorConf.Type == "composite" {
+			v.add(prefix, "type: unknown %q, expected one of sqs, pubsub, rabbitmq", colectorConf.Type)
+			continue
+		}
+		colectorFields := make(map[string]json.RawMessage)
+		json.Unmarshal(raw, &colectorFields)
+		for _, name := range controllerFields {
+			if _, found := colectorFields[name]; found {
+				v.add(prefix, "%s: not supported in a collector, set it on the composite", name)
+				delete(colectorFields, name)
+			}
+		}
+		v.checkFields(prefix, colectorType, colectorFields, string(raw))
+		if _, found := colectorFields["expression"]; found && conf.Expression != "" {
+			v.add(prefix, "expression: not supported with the expression of the composite")
+		} else if colectorConf.Expression != base.Expression {
+			if _, err := expression.Parse(colectorConf.Expression); err != nil {
+				v.add(prefix, "expression: %s", err)
+			}
+		}
+		if colectorConf.Timezone != base.Timezone {
+			if _, err := time.LoadLocation(colectorConf.Timezone); err != nil {
+				v.add(prefix, "timezone: %s", err)
+			}
+		}
+		if conf.Expression == "" {
+			v.checkColector(prefix, colectorConf.Type, string(raw), colectorConf)
+		} else {
+			v.checkColector(prefix, colectorConf.Type, string(raw), conf)
+		}
+	}
+}
+
+// checkFields reports the fields unknown to confType and the ones with the
+// wrong type.
+func (v *validator) checkFields(prefix string, confType reflect.Type, fields map[string]json.RawMessage, confJSON string) {
+	known := jsonFields(confType)
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, found := known[name]; !found {
+			v.add(prefix, "%s: unknown field", name)
+		}
+	}
+	if err := json.Unmarshal([]byte(confJSON), reflect.New(confType).Interface()); err != nil {
+		v.add(prefix, "%s", err)
+	}
+}
+
+func (v *validator) checkBase(conf config.Config) {
+	if conf.Namespace == "" {
+		v.add("", "namespace: required")
+	}
+	if conf.Deployment == "" {
+		v.add("", "deployment: required")
+	}
+	if conf.Interval == "" {
+		v.add("", "interval: required")
+	} else if d, err := time.ParseDuration(conf.Interval); err != nil || d <= 0 {
+		v.add("", "interval: invalid duration %q", conf.Interval)
+	}
+	if !contains(scaleMethods, conf.ScaleMethod) {
+		v.add("", "scale_method: unknown %q, expected one of %s", conf.ScaleMethod, strings.Join(scaleMethods[1:], ", "))
+	}
+	if conf.ScaleMethod == JobScaleMethod && conf.TargetKind != "" && !k8s.IsJobKind(conf.TargetKind) {
+		v.add("", "target_kind: scale_method %s requires %s or %s", JobScaleMethod, k8s.JobKind, k8s.CronJobKind)
+	}
+	v.checkBounds("", conf.Min, conf.Max)
+	if err := checkScaleToZero(conf); err != nil {
+		v.add("", "%s", err)
+	}
+	if !contains(roundings, conf.Rounding) {
+		v.add("", "rounding: unknown %q", conf.Rounding)
+	}
+	if conf.Tolerance < 0 || conf.Tolerance >= 1 {
+		v.add("", "tolerance: must be at least 0 and less than 1")
+	}
+	if conf.Timezone != "" {
+		if _, err := time.LoadLocation(conf.Timezone); err != nil {
+			v.add("", "timezone: %s", err)
+		}
+	}
+	if conf.ActivationThreshold < 0 {
+		v.add("", "activation_threshold: must not be negative")
+	}
+	if conf.InitialReplicas < 0 {
+		v.add("", "initial_replicas: must not be negative")
+	}
+	if conf.IdlePeriod != "" {
+		if _, err := time.ParseDuration(conf.IdlePeriod); err != nil {
+			v.add("", "idle_period: invalid duration %q", conf.IdlePeriod)
+		}
+	}
+	if conf.ScaleDownProbePort < 0 || conf.ScaleDownProbePort > 65535 {
+		v.add("", "scale_down_probe_port: invalid port %d", conf.ScaleDownProbePort)
+	} else if err := checkScaleDownProbe(conf); err != nil {
+		v.add("", "%s", err)
+	}
+	if conf.Expression != "" {
+		if _, err := expression.Parse(conf.Expression); err != nil {
+			v.add("", "expression: %s", err)
+		}
+	}
+
+	for i, s := range conf.Schedules {
+		prefix := fmt.Sprintf("schedules[%d].", i)
+		if _, err := cron.Parse(s.Cron); err != nil {
+			v.add(prefix, "cron: %s", err)
+		}
+		if d, err := time.ParseDuration(s.Duration); err != nil || d <= 0 {
+			v.add(prefix, "duration: invalid duration %q", s.Duration)
+		}
+		if s.Timezone != "" {
+			if _, err := time.LoadLocation(s.Timezone); err != nil {
+				v.add(prefix, "timezone: %s", err)
+			}
+		}
+		scheduled := s.Apply(conf)
+		v.checkBounds(prefix, scheduled.Min, scheduled.Max)
+		if s.MsgsPerPod != nil && *s.MsgsPerPod <= 0 {
+			v.add(prefix, "msgs_per_pod: must be greater than 0")
+		}
+	}
+}
+
+func (v *validator) checkBounds(prefix string, min, max int) {
+	if min < 0 {
+		v.add(prefix, "min: must not be negative")
+	}
+	if max <= 0 {
+		v.add(prefix, "max: must be greater than 0")
+	}
+	if min > max {
+		v.add(prefix, "min: %d is greater than max %d", min, max)
+	}
+}
+
+// checkColector checks the fields used to collect and crunch the metrics of
+// colectorType, conf is the effective config of the collector.
+func (v *validator) checkColector(prefix, colectorType, confJSON string, conf config.Config) {
+	if conf.Expression == "" && conf.MsgsPerPod <= 0 {
+		v.add(prefix, "msgs_per_pod: must be greater than 0")
+	}
+	switch colectorType {
+	case "sqs":
+		c := SQSControlerConfig{}
+		json.Unmarshal([]byte(confJSON), &c)
+		if len(c.QueueURLs) == 0 {
+			v.add(prefix, "queue_urls: at least one queue is required")
+		}
+		hasKey := c.Key != "" || c.KeySecretRef != nil
+		hasSecret := c.Secret != "" || c.SecretSecretRef != nil
+		if hasKey && !hasSecret {
+			v.add(prefix, "secret: required with key")
+		} else if hasSecret && !hasKey {
+			v.add(prefix, "key: required with secret")
+		}
+	case "rabbitmq":
+		c := RabbitMQControlerConfig{}
+		json.Unmarshal([]byte(confJSON), &c)
+		if len(c.QueueURLs) == 0 {
+			v.add(prefix, "queue_urls: at least one queue is required")
+		}
+	case "pubsub":
+		c := PubSubControlerConfig{}
+		json.Unmarshal([]byte(confJSON), &c)
+		if len(c.SubscriptionIDs) == 0 {
+			v.add(prefix, "subscription_ids: at least one subscription is required")
+		}
+		if c.Project == "" {
+			v.add(prefix, "project: required")
+		}
+	}
+}
+
+func (v *validator) checkSecretRefs(confJSON string) {
+	refs, err := secretRefs(confJSON)
+	if err != nil {
+		v.add("", "%s", err)
+		return
+	}
+	for _, ref := range refs {
+		if ref.Name == "" || ref.Key == "" {
+			v.add("", "secret refs require name and key, got %+v", ref)
+		}
+	}
+}
+
+// jsonFields maps the json names of the fields of t (and of its embedded
+// structs) to their types.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			for name, ft := range jsonFields(f.Type) {
+				fields[name] = ft
+			}
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+func controllerTypes() []string {
+	types := make([]string, 0, len(controllerConfigs))
+	for t := range controllerConfigs {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	valid := []string{
+		`{"namespace": "ns", "deployment": "d", "type": "sqs", "interval": "30s", "max": 5, "msgs_per_pod": 10, "queue_urls": ["q"], "region": "us-east-1"}`,
+		`{"namespace": "ns", "deployment": "d", "type": "rabbitmq", "interval": "1m", "max": 5, "expression": "msgsInQueue / 10", "queue_urls": ["q"], "scale_method": "DEPLOY"}`,
+		`{"namespace": "ns", "deployment": "d", "type": "composite", "interval": "1m", "max": 5, "msgs_per_pod": 10, "aggregation": "sum", "collectors": [
+			{"type": "sqs", "queue_urls": ["q"]},
+			{"type": "pubsub", "subscription_ids": ["s"], "project": "p", "msgs_per_pod": 20, "expression": "ceil(msgsInQueue / 20)"}
+		]}`,
+	}
+	for _, confJSON := range valid {
+		if err := Validate(confJSON); err != nil {
+			t.Errorf("unexpected error for %s: %s", confJSON, err)
+		}
+	}
+
+	testCases := []struct {
+		confJSON string
+		errors   []string
+	}{
+		{`{"type": "kafka"}`, []string{"type: unknown"}},
+		{
+			`{"type": "sqs", "interval": "often", "min": 5, "max": 2, "msg_per_pod": 10, "scale_method": "SCALE"}`,
+			[]string{
+				"msg_per_pod: unknown field",
+				"namespace: required",
+				"deployment: required",
+				"interval: invalid duration",
+				"scale_method: unknown",
+				"min: 5 is greater than max 2",
+				"msgs_per_pod: must be greater than 0",
+				"queue_urls: at least one queue is required",
+			},
+		},
+		{
+			`{"namespace": "ns", "deployment": "d", "type": "sqs", "interval": "1m", "max": 1, "msgs_per_pod": 1, "queue_urls": "q"}`,
+			[]string{"cannot unmarshal string", "queue_urls: at least one queue is required"},
+		},
+		{
+			`{"namespace": "ns", "deployment": "d", "type": "sqs", "interval": "1m", "max": 1, "msgs_per_pod": 1, "queue_urls": ["q"],
+			"schedules": [{"cron": "* * *", "duration": "1h", "max": 0}]}`,
+			[]string{"schedules[0].cron:", "schedules[0].max: must be greater than 0"},
+		},
+		{
+			`{"namespace": "ns", "deployment": "d", "type": "composite", "interval": "1m", "max": 1, "aggregation": "median", "collectors": [
+				{"type": "sqs", "queue_urls": ["q"], "msgs_per_pod": 1, "queue_url": "q"},
+				{"type": "pubsub", "msgs_per_pod": 1},
+				{"type": "composite"}
+			]}`,
+			[]string{
+				"aggregation: unknown",
+				"collectors[0].queue_url: unknown field",
+				"collectors[1].subscription_ids: at least one subscription is required",
+				"collectors[1].project: required",
+				"collectors[2].type: unknown",
+			},
+		},
+		{
+			`{"namespace": "ns", "deployment": "d", "type": "rabbitmq", "interval": "1m", "max": 1, "msgs_per_pod": 1, "queue_urls": ["q"], "credentials_secret_ref": {"name": "rabbit"}}`,
+			[]string{"secret refs require name and key"},
+		},
+		{
+			`{"namespace": "ns", "deployment": "d", "type": "composite", "interval": "1m", "max": 1, "expression": "ceil(c0_msgsInQueue", "collectors": [
+				{"type": "sqs", "queue_urls": ["q"], "key": "k", "schedules": [], "expression": "1", "scale_method": "HPA"}
+			]}`,
+			[]string{
+				"expression: unexpected end of expression",
+				"collectors[0].schedules: not supported in a collector",
+				"collectors[0].scale_method: not supported in a collector",
+				"collectors[0].expression: not supported with the expression of the composite",
+				"collectors[0].secret: required with key",
+			},
+		},
+		{
+			`{"namespace": "ns", "deployment": "d", "type": "sqs", "interval": "1m", "min": 1, "max": 1, "msgs_per_pod": 1, "queue_urls": ["q"],
+			"scale_method": "HPA", "scale_down_probe_port": 8080}`,
+			[]string{"scale_down_probe_port: only supported when scaling deployments"},
+		},
+		{
+			`{"namespace": "ns", "deployment": "d", "type": "sqs", "interval": "1m", "min": 1, "max": 1, "msgs_per_pod": 1, "queue_urls": ["q"],
+			"scale_method": "EXTERNAL", "schedules": [{"cron": "0 0 * * *", "duration": "1h", "min": 0}]}`,
+			[]string{"min: scale_method EXTERNAL can't scale to zero"},
+		},
+		{
+			`{"namespace": "ns", "deployment": "d", "type": "sqs", "interval": "1m", "max": 1, "msgs_per_pod": 1, "queue_urls": ["q"], "tolerance": 1}`,
+			[]string{"tolerance: must be at least 0 and less than 1"},
+		},
+	}
+	for _, tc := range testCases {
+		err := Validate(tc.confJSON)
+		verr, ok := err.(*ValidationError)
+		if !ok {
+			t.Errorf("expected validation error for %s, got %v", tc.confJSON, err)
+			continue
+		}
+		if len(verr.Errors) != len(tc.errors) {
+			t.Errorf("expected %d errors for %s, got %v", len(tc.errors), tc.confJSON, verr.Errors)
+		}
+		for _, expected := range tc.errors {
+			if !strings.Contains(err.Error(), expected) {
+				t.Errorf("expected error %q for %s, got %s", expected, tc.confJSON, err)
+			}
+		}
+	}
+}
+
+func TestSchemaFileIsUpToDate(t *testing.T) {
+	schema, err := Schema()
+	if err != nil {
+		t.Fatal("error generating schema", err)
+	}
+	file, err := ioutil.ReadFile("../mitose-config.schema.json")
+	if err != nil {
+		t.Fatal("error reading schema file", err)
+	}
+	if !bytes.Equal(bytes.TrimSpace(file), schema) {
+		t.Error("mitose-config.schema.json is outdated, regenerate it with mitose -schema")
+	}
+}
@@ -0,0 +1,139 @@
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type field struct {
+	name string
+	min  int
+	max  int
+}
+
+var fields = []field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// Expression is a standard five fields cron expression
+// (minute, hour, day of month, month and day of week).
+type Expression struct {
+	source   string
+	minutes  map[int]bool
+	hours    map[int]bool
+	days     map[int]bool
+	months   map[int]bool
+	weekdays map[int]bool
+	anyDay   bool
+	anyWeek  bool
+}
+
+func Parse(source string) (*Expression, error) {
+	parts := strings.Fields(source)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("cron expression %q must have %d fields", source, len(fields))
+	}
+	sets := make([]map[int]bool, len(fields))
+	for i, part := range parts {
+		set, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: %v", source, err)
+		}
+		sets[i] = set
+	}
+	// sunday can be both 0 and 7
+	if sets[4][7] {
+		sets[4][0] = true
+	}
+	return &Expression{
+		source:   source,
+		minutes:  sets[0],
+		hours:    sets[1],
+		days:     sets[2],
+		months:   sets[3],
+		weekdays: sets[4],
+		anyDay:   parts[2] == "*",
+		anyWeek:  parts[4] == "*",
+	}, nil
+}
+
+func parseField(part string, f field) (map[int]bool, error) {
+	set := make(map[int]bool)
+	for _, item := range strings.Split(part, ",") {
+		step := 1
+		if i := strings.Index(item, "/"); i != -1 {
+			var err error
+			if step, err = strconv.Atoi(item[i+1:]); err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step %q on %s", item[i+1:], f.name)
+			}
+			item = item[:i]
+		}
+
+		start, end := f.min, f.max
+		if item != "*" {
+			bounds := strings.SplitN(item, "-", 2)
+			var err error
+			if start, err = parseValue(bounds[0], f); err != nil {
+				return nil, err
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = parseValue(bounds[1], f); err != nil {
+					return nil, err
+				}
+			} else if step != 1 {
+				end = f.max
+			}
+			if end < start {
+				return nil, fmt.Errorf("invalid range %q on %s", item, f.name)
+			}
+		}
+
+		for v := start; v <= end; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+func parseValue(s string, f field) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid value %q on %s", s, f.name)
+	}
+	return v, nil
+}
+
+// Matches reports whether the expression fires on the minute of t.
+func (e *Expression) Matches(t time.Time) bool {
+	if !e.minutes[t.Minute()] || !e.hours[t.Hour()] || !e.months[int(t.Month())] {
+		return false
+	}
+	day, weekday := e.days[t.Day()], e.weekdays[int(t.Weekday())]
+	// like the classic cron, when both day fields are restricted either one matches
+	if !e.anyDay && !e.anyWeek {
+		return day || weekday
+	}
+	return day && weekday
+}
+
+// FiredWithin reports whether the expression fired on the period d ending at t.
+func (e *Expression) FiredWithin(t time.Time, d time.Duration) bool {
+	t = t.Truncate(time.Minute)
+	for elapsed := time.Duration(0); elapsed < d; elapsed += time.Minute {
+		if e.Matches(t.Add(-elapsed)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Expression) String() string {
+	return e.source
+}
@@ -0,0 +1,83 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMatches(t *testing.T) {
+	// 2018-11-23 was a friday
+	blackFriday := time.Date(2018, time.November, 23, 10, 30, 0, 0, time.UTC)
+
+	var testCases = []struct {
+		expression string
+		expected   bool
+	}{
+		{"* * * * *", true},
+		{"30 10 * * *", true},
+		{"31 10 * * *", false},
+		{"*/15 * * * *", true},
+		{"*/7 * * * *", false},
+		{"0-30 9-18 * * 1-5", true},
+		{"* * * * 0,6", false},
+		{"* * 23 11 *", true},
+		{"* * 24 11 *", false},
+		{"* * 1 * 5", true},
+		{"* * 23 * 0", true},
+		{"* * * 12 *", false},
+	}
+
+	for _, tc := range testCases {
+		e, err := Parse(tc.expression)
+		if err != nil {
+			t.Fatalf("error parsing %q: %v", tc.expression, err)
+		}
+		if actual := e.Matches(blackFriday); actual != tc.expected {
+			t.Errorf("%q: expected %t, got %t", tc.expression, tc.expected, actual)
+		}
+	}
+}
+
+func TestMatchesSunday(t *testing.T) {
+	sunday := time.Date(2018, time.November, 25, 0, 0, 0, 0, time.UTC)
+	for _, expression := range []string{"0 0 * * 0", "0 0 * * 7"} {
+		e, err := Parse(expression)
+		if err != nil {
+			t.Fatalf("error parsing %q: %v", expression, err)
+		}
+		if !e.Matches(sunday) {
+			t.Errorf("%q: expected to match sunday", expression)
+		}
+	}
+}
+
+func TestFiredWithin(t *testing.T) {
+	e, err := Parse("0 22 * * *")
+	if err != nil {
+		t.Fatal("error parsing cron expression", err)
+	}
+
+	var testCases = []struct {
+		t        time.Time
+		expected bool
+	}{
+		{time.Date(2018, time.November, 23, 21, 59, 0, 0, time.UTC), false},
+		{time.Date(2018, time.November, 23, 22, 0, 0, 0, time.UTC), true},
+		{time.Date(2018, time.November, 24, 1, 59, 59, 0, time.UTC), true},
+		{time.Date(2018, time.November, 24, 2, 0, 0, 0, time.UTC), false},
+	}
+
+	for _, tc := range testCases {
+		if actual := e.FiredWithin(tc.t, 4*time.Hour); actual != tc.expected {
+			t.Errorf("%s: expected %t, got %t", tc.t, tc.expected, actual)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expression := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+		if _, err := Parse(expression); err == nil {
+			t.Errorf("expected error parsing %q", expression)
+		}
+	}
+}
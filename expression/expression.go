@@ -0,0 +1,374 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"unicode"
+)
+
+var ErrDivisionByZero = errors.New("division by zero")
+
+type Vars map[string]float64
+
+type Expression struct {
+	source string
+	root   node
+}
+
+type node interface {
+	eval(Vars) (float64, error)
+}
+
+type number float64
+
+type variable string
+
+type unaryOp struct {
+	op      string
+	operand node
+}
+
+type binaryOp struct {
+	op          string
+	left, right node
+}
+
+type call struct {
+	name string
+	args []node
+}
+
+func (n number) eval(Vars) (float64, error) {
+	return float64(n), nil
+}
+
+func (v variable) eval(vars Vars) (float64, error) {
+	value, found := vars[string(v)]
+	if !found {
+		return 0, fmt.Errorf("unknown variable %q", string(v))
+	}
+	return value, nil
+}
+
+func (u *unaryOp) eval(vars Vars) (float64, error) {
+	v, err := u.operand.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	if u.op == "-" {
+		return -v, nil
+	}
+	return v, nil
+}
+
+func (b *binaryOp) eval(vars Vars) (float64, error) {
+	l, err := b.left.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	r, err := b.right.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	switch b.op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return 0, ErrDivisionByZero
+		}
+		return l / r, nil
+	case "%":
+		if r == 0 {
+			return 0, ErrDivisionByZero
+		}
+		return math.Mod(l, r), nil
+	case "<":
+		return boolToFloat(l < r), nil
+	case "<=":
+		return boolToFloat(l <= r), nil
+	case ">":
+		return boolToFloat(l > r), nil
+	case ">=":
+		return boolToFloat(l >= r), nil
+	case "==":
+		return boolToFloat(l == r), nil
+	case "!=":
+		return boolToFloat(l != r), nil
+	}
+	return 0, fmt.Errorf("invalid operator %q", b.op)
+}
+
+func (c *call) eval(vars Vars) (float64, error) {
+	args := make([]float64, len(c.args))
+	for i, arg := range c.args {
+		v, err := arg.eval(vars)
+		if err != nil {
+			return 0, err
+		}
+		args[i] = v
+	}
+	switch c.name {
+	case "ceil":
+		return math.Ceil(args[0]), nil
+	case "floor":
+		return math.Floor(args[0]), nil
+	case "round":
+		return math.Round(args[0]), nil
+	case "abs":
+		return math.Abs(args[0]), nil
+	case "min":
+		return reduce(args, math.Min), nil
+	case "max":
+		return reduce(args, math.Max), nil
+	case "if":
+		if args[0] != 0 {
+			return args[1], nil
+		}
+		return args[2], nil
+	}
+	return 0, fmt.Errorf("unknown function %q", c.name)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func reduce(args []float64, f func(float64, float64) float64) float64 {
+	result := args[0]
+	for _, arg := range args[1:] {
+		result = f(result, arg)
+	}
+	return result
+}
+
+// functions maps each supported function to its number of arguments,
+// -1 means one or more arguments.
+var functions = map[string]int{
+	"ceil":  1,
+	"floor": 1,
+	"round": 1,
+	"abs":   1,
+	"min":   -1,
+	"max":   -1,
+	"if":    3,
+}
+
+func (e *Expression) Eval(vars Vars) (float64, error) {
+	return e.root.eval(vars)
+}
+
+func (e *Expression) String() string {
+	return e.source
+}
+
+func Parse(source string) (*Expression, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.tokens[p.pos].text, p.tokens[p.pos].pos)
+	}
+	return &Expression{source: source, root: root}, nil
+}
+
+type tokenKind int
+
+const (
+	numberToken tokenKind = iota
+	identToken
+	operatorToken
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	runes := []rune(source)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r) || r == '.':
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{numberToken, string(runes[start:i]), start})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{identToken, string(runes[start:i]), start})
+		default:
+			op := string(r)
+			if i+1 < len(runes) && runes[i+1] == '=' && (r == '<' || r == '>' || r == '=' || r == '!') {
+				op += "="
+			}
+			switch op {
+			case "+", "-", "*", "/", "%", "(", ")", ",", "<", "<=", ">", ">=", "==", "!=":
+			default:
+				return nil, fmt.Errorf("unexpected %q at position %d", op, i)
+			}
+			tokens = append(tokens, token{operatorToken, op, i})
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek(ops ...string) (string, bool) {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != operatorToken {
+		return "", false
+	}
+	for _, op := range ops {
+		if p.tokens[p.pos].text == op {
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) expect(op string) error {
+	if _, ok := p.peek(op); !ok {
+		return p.unexpected()
+	}
+	p.pos++
+	return nil
+}
+
+func (p *parser) unexpected() error {
+	if p.pos >= len(p.tokens) {
+		return errors.New("unexpected end of expression")
+	}
+	t := p.tokens[p.pos]
+	return fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+}
+
+func (p *parser) parseBinary(next func() (node, error), ops ...string) (node, error) {
+	left, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.peek(ops...)
+		if !ok {
+			return left, nil
+		}
+		p.pos++
+		right, err := next()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryOp{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseComparison() (node, error) {
+	return p.parseBinary(p.parseSum, "<", "<=", ">", ">=", "==", "!=")
+}
+
+func (p *parser) parseSum() (node, error) {
+	return p.parseBinary(p.parseProduct, "+", "-")
+}
+
+func (p *parser) parseProduct() (node, error) {
+	return p.parseBinary(p.parseUnary, "*", "/", "%")
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if op, ok := p.peek("-", "+"); ok {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryOp{op: op, operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, p.unexpected()
+	}
+	t := p.tokens[p.pos]
+	switch t.kind {
+	case numberToken:
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", t.text, t.pos)
+		}
+		p.pos++
+		return number(v), nil
+	case identToken:
+		p.pos++
+		if _, ok := p.peek("("); ok {
+			return p.parseCall(t)
+		}
+		return variable(t.text), nil
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	n, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	return n, p.expect(")")
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	arity, found := functions[name.text]
+	if !found {
+		return nil, fmt.Errorf("unknown function %q at position %d", name.text, name.pos)
+	}
+	p.pos++ // skip "("
+	var args []node
+	if _, ok := p.peek(")"); !ok {
+		for {
+			arg, err := p.parseComparison()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if _, ok := p.peek(","); !ok {
+				break
+			}
+			p.pos++
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if (arity == -1 && len(args) == 0) || (arity != -1 && len(args) != arity) {
+		return nil, fmt.Errorf("wrong number of arguments to %s at position %d", name.text, name.pos)
+	}
+	return &call{name: name.text, args: args}, nil
+}
@@ -0,0 +1,61 @@
+package expression
+
+import "testing"
+
+func TestEval(t *testing.T) {
+	vars := Vars{"ready": 120, "unacked": 40, "replicas": 3, "hour": 10}
+
+	var testCases = []struct {
+		expression string
+		expected   float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"-replicas + 1", -2},
+		{"ceil((ready + 0.5*unacked) / 50) + 1", 4},
+		{"floor(ready / 50)", 2},
+		{"round(2.5)", 3},
+		{"abs(1 - replicas)", 2},
+		{"max(1, replicas, 2)", 3},
+		{"min(ready, unacked)", 40},
+		{"7 % 4", 3},
+		{"if(hour >= 9, 10, 1)", 10},
+		{"if(hour < 9, 10, 1)", 1},
+		{"replicas == 3", 1},
+		{"replicas != 3", 0},
+	}
+
+	for _, tc := range testCases {
+		e, err := Parse(tc.expression)
+		if err != nil {
+			t.Fatalf("error parsing %q: %v", tc.expression, err)
+		}
+		actual, err := e.Eval(vars)
+		if err != nil {
+			t.Fatalf("error evaluating %q: %v", tc.expression, err)
+		}
+		if actual != tc.expected {
+			t.Errorf("%q: expected %f, got %f", tc.expression, tc.expected, actual)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expression := range []string{"", "1 +", "(1 + 2", "1 2", "foo(1)", "ceil(1, 2)", "max()", "1 $ 2", "1..2"} {
+		if _, err := Parse(expression); err == nil {
+			t.Errorf("expected error parsing %q", expression)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	for _, expression := range []string{"unknown + 1", "1 / 0", "1 % (2 - 2)"} {
+		e, err := Parse(expression)
+		if err != nil {
+			t.Fatalf("error parsing %q: %v", expression, err)
+		}
+		if _, err := e.Eval(Vars{}); err == nil {
+			t.Errorf("expected error evaluating %q", expression)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package external
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/luizalabs/mitose/k8s"
+)
+
+const (
+	Group        = "external.metrics.k8s.io"
+	Version      = "v1beta1"
+	GroupVersion = Group + "/" + Version
+
+	// DeploymentLabel identifies the controller of each metric on the HPA selector.
+	DeploymentLabel = "deployment"
+
+	defaultPort = "6443"
+
+	// the CA of the client certificates of the aggregator is published on
+	// this config map for the extension API servers
+	authenticationNamespace = "kube-system"
+	authenticationConfigMap = "extension-apiserver-authentication"
+)
+
+type ExternalMetricValue struct {
+	MetricName   string            `json:"metricName"`
+	MetricLabels map[string]string `json:"metricLabels"`
+	Timestamp    metav1.Time       `json:"timestamp"`
+	Value        resource.Quantity `json:"value"`
+}
+
+type ExternalMetricValueList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []ExternalMetricValue `json:"items"`
+}
+
+type metricKey struct {
+	namespace  string
+	deployment string
+	name       string
+}
+
+type metric struct {
+	value     float64
+	timestamp time.Time
+	expires   time.Time
+}
+
+var (
+	mu      = new(sync.Mutex)
+	metrics = make(map[metricKey]metric)
+)
+
+// Set publishes the value of the metric name collected for deployment, it is
+// served until ttl passes without a new value.
+func Set(namespace, deployment, name string, value float64, ttl time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	now := time.Now()
+	metrics[metricKey{namespace, deployment, name}] = metric{value: value, timestamp: now, expires: now.Add(ttl)}
+}
+
+// Delete stops serving the metrics of deployment.
+func Delete(namespace, deployment string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for k := range metrics {
+		if k.namespace == namespace && k.deployment == deployment {
+			delete(metrics, k)
+		}
+	}
+}
+
+// current returns the metrics not expired, mu must be held.
+func current() map[metricKey]metric {
+	now := time.Now()
+	for k, m := range metrics {
+		if now.After(m.expires) {
+			delete(metrics, k)
+		}
+	}
+	return metrics
+}
+
+// Handler serves the external metrics API, the metrics of a namespace are
+// labeled with the name of their deployment.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/apis", serveGroupList)
+	mux.HandleFunc("/apis/"+Group, serveGroup)
+	mux.HandleFunc("/apis/"+GroupVersion, serveResourceList)
+	mux.HandleFunc("/apis/"+GroupVersion+"/", serveMetrics)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) })
+	return mux
+}
+
+// Run serves Handler over TLS on $EXTERNAL_METRICS_PORT, with the certificate
+// of $EXTERNAL_METRICS_CERT_FILE and $EXTERNAL_METRICS_KEY_FILE trusted by the
+// caBundle of the APIService. Only the aggregator, authenticated by its
+// client certificate, can read the metrics.
+func Run() error {
+	port := os.Getenv("EXTERNAL_METRICS_PORT")
+	if port == "" {
+		port = defaultPort
+	}
+	certificate, err := tls.LoadX509KeyPair(os.Getenv("EXTERNAL_METRICS_CERT_FILE"), os.Getenv("EXTERNAL_METRICS_KEY_FILE"))
+	if err != nil {
+		return err
+	}
+	data, err := k8s.GetConfigMapData(authenticationNamespace, authenticationConfigMap)
+	if err != nil {
+		return err
+	}
+	auth, err := newRequestHeaderAuth(data)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%s", port),
+		Handler: auth.Handler(Handler()),
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{certificate},
+			ClientCAs:    auth.clientCAs,
+			ClientAuth:   tls.VerifyClientCertIfGiven,
+		},
+	}
+	return server.ListenAndServeTLS("", "")
+}
+
+// requestHeaderAuth authenticates the aggregator like the extension API
+// servers do: its client certificate must be signed by the requestheader CA
+// and, when the allowed names are set, have one of them as common name.
+type requestHeaderAuth struct {
+	clientCAs    *x509.CertPool
+	allowedNames []string
+}
+
+func newRequestHeaderAuth(data map[string]string) (*requestHeaderAuth, error) {
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM([]byte(data["requestheader-client-ca-file"])) {
+		return nil, errors.New("no requestheader-client-ca-file on " + authenticationNamespace + "/" + authenticationConfigMap)
+	}
+	auth := &requestHeaderAuth{clientCAs: clientCAs}
+	if names := data["requestheader-allowed-names"]; names != "" {
+		if err := json.Unmarshal([]byte(names), &auth.allowedNames); err != nil {
+			return nil, fmt.Errorf("invalid requestheader-allowed-names: %s", err)
+		}
+	}
+	return auth, nil
+}
+
+// Handler rejects the requests of other clients, except the health checks.
+func (a *requestHeaderAuth) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" && !a.authenticated(r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (a *requestHeaderAuth) authenticated(r *http.Request) bool {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return false
+	}
+	if len(a.allowedNames) == 0 {
+		return true
+	}
+	commonName := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	for _, name := range a.allowedNames {
+		if name == commonName {
+			return true
+		}
+	}
+	return false
+}
+
+func serveGroupList(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, &metav1.APIGroupList{
+		TypeMeta: metav1.TypeMeta{Kind: "APIGroupList", APIVersion: "v1"},
+		Groups:   []metav1.APIGroup{apiGroup()},
+	})
+}
+
+func serveGroup(w http.ResponseWriter, r *http.Request) {
+	group := apiGroup()
+	group.TypeMeta = metav1.TypeMeta{Kind: "APIGroup", APIVersion: "v1"}
+	writeJSON(w, &group)
+}
+
+func apiGroup() metav1.APIGroup {
+	version := metav1.GroupVersionForDiscovery{GroupVersion: GroupVersion, Version: Version}
+	return metav1.APIGroup{
+		Name:             Group,
+		Versions:         []metav1.GroupVersionForDiscovery{version},
+		PreferredVersion: version,
+	}
+}
+
+func serveResourceList(w http.ResponseWriter, r *http.Request) {
+	mu.Lock()
+	names := make(map[string]bool)
+	for k := range current() {
+		names[k.name] = true
+	}
+	mu.Unlock()
+
+	resources := make([]metav1.APIResource, 0, len(names))
+	for name := range names {
+		resources = append(resources, metav1.APIResource{
+			Name:       name,
+			Namespaced: true,
+			Kind:       "ExternalMetricValueList",
+			Verbs:      metav1.Verbs{"get"},
+		})
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i].Name < resources[j].Name })
+
+	writeJSON(w, &metav1.APIResourceList{
+		TypeMeta:     metav1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"},
+		GroupVersion: GroupVersion,
+		APIResources: resources,
+	})
+}
+
+// serveMetrics handles /apis/external.metrics.k8s.io/v1beta1/namespaces/<namespace>/<metric>
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/apis/"+GroupVersion+"/"), "/")
+	if len(parts) != 3 || parts[0] != "namespaces" {
+		http.NotFound(w, r)
+		return
+	}
+	namespace, name := parts[1], parts[2]
+	selector, err := labels.Parse(r.URL.Query().Get("labelSelector"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mu.Lock()
+	items := make([]ExternalMetricValue, 0)
+	for k, m := range current() {
+		metricLabels := map[string]string{DeploymentLabel: k.deployment}
+		if k.namespace != namespace || k.name != name || !selector.Matches(labels.Set(metricLabels)) {
+			continue
+		}
+		items = append(items, ExternalMetricValue{
+			MetricName:   k.name,
+			MetricLabels: metricLabels,
+			Timestamp:    metav1.NewTime(m.timestamp),
+			Value:        *resource.NewMilliQuantity(int64(math.Round(m.value*1000)), resource.DecimalSI),
+		})
+	}
+	mu.Unlock()
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].MetricLabels[DeploymentLabel] < items[j].MetricLabels[DeploymentLabel]
+	})
+
+	writeJSON(w, &ExternalMetricValueList{
+		TypeMeta: metav1.TypeMeta{Kind: "ExternalMetricValueList", APIVersion: GroupVersion},
+		Items:    items,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
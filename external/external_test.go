@@ -0,0 +1,125 @@
+package external
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func getJSON(t *testing.T, url string, v interface{}) int {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal("error requesting", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal("error decoding", url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestHandler(t *testing.T) {
+	Set("fakeNS", "fakeDeploy", "msgsInQueue", 42, time.Minute)
+	Set("fakeNS", "otherDeploy", "msgsInQueue", 7, time.Minute)
+	Set("otherNS", "fakeDeploy", "msgsInQueue", 1, time.Minute)
+	Set("fakeNS", "fakeDeploy", "desiredReplicas", 1.5, time.Minute)
+
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+
+	resources := new(metav1.APIResourceList)
+	getJSON(t, server.URL+"/apis/"+GroupVersion, resources)
+	if len(resources.APIResources) != 2 {
+		t.Errorf("expected 2 resources, got %v", resources.APIResources)
+	}
+
+	var testCases = []struct {
+		path     string
+		expected []string
+	}{
+		{"/namespaces/fakeNS/msgsInQueue", []string{"42", "7"}},
+		{"/namespaces/fakeNS/msgsInQueue?labelSelector=deployment%3DfakeDeploy", []string{"42"}},
+		{"/namespaces/otherNS/msgsInQueue", []string{"1"}},
+		{"/namespaces/fakeNS/desiredReplicas", []string{"1500m"}},
+		{"/namespaces/fakeNS/unknown", []string{}},
+	}
+
+	for _, tc := range testCases {
+		list := new(ExternalMetricValueList)
+		if status := getJSON(t, server.URL+"/apis/"+GroupVersion+tc.path, list); status != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", tc.path, status)
+		}
+		if len(list.Items) != len(tc.expected) {
+			t.Errorf("%s: expected %d items, got %d", tc.path, len(tc.expected), len(list.Items))
+			continue
+		}
+		for i, item := range list.Items {
+			if item.Value.String() != tc.expected[i] {
+				t.Errorf("%s: expected %s, got %s", tc.path, tc.expected[i], item.Value.String())
+			}
+		}
+	}
+
+	if status := getJSON(t, server.URL+"/apis/"+GroupVersion+"/msgsInQueue", nil); status != http.StatusNotFound {
+		t.Errorf("expected status 404 for a path without namespace, got %d", status)
+	}
+}
+
+func TestExpiryAndDelete(t *testing.T) {
+	Set("expiryNS", "stale", "msgsInQueue", 1, -time.Second)
+	Set("expiryNS", "stopped", "msgsInQueue", 2, time.Minute)
+	Set("expiryNS", "running", "msgsInQueue", 3, time.Minute)
+	Delete("expiryNS", "stopped")
+
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+
+	list := new(ExternalMetricValueList)
+	getJSON(t, server.URL+"/apis/"+GroupVersion+"/namespaces/expiryNS/msgsInQueue", list)
+	if len(list.Items) != 1 || list.Items[0].MetricLabels[DeploymentLabel] != "running" {
+		t.Errorf("expected only the metric of the running deployment, got %v", list.Items)
+	}
+}
+
+func TestRequestHeaderAuth(t *testing.T) {
+	if _, err := newRequestHeaderAuth(map[string]string{}); err == nil {
+		t.Error("expected error without the requestheader CA")
+	}
+
+	auth := &requestHeaderAuth{allowedNames: []string{"front-proxy-client"}}
+	verified := func(commonName string) *tls.ConnectionState {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+		return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	var testCases = []struct {
+		path     string
+		tls      *tls.ConnectionState
+		expected int
+	}{
+		{"/apis", verified("front-proxy-client"), http.StatusOK},
+		{"/apis", verified("someone-else"), http.StatusUnauthorized},
+		{"/apis", &tls.ConnectionState{}, http.StatusUnauthorized},
+		{"/apis", nil, http.StatusUnauthorized},
+		{"/healthz", nil, http.StatusOK},
+	}
+
+	handler := auth.Handler(Handler())
+	for _, tc := range testCases {
+		r := httptest.NewRequest("GET", tc.path, nil)
+		r.TLS = tc.tls
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tc.expected {
+			t.Errorf("%s: expected status %d, got %d", tc.path, tc.expected, w.Code)
+		}
+	}
+}
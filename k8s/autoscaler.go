@@ -0,0 +1,185 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	AutoscalerGroup   = "mitose.luizalabs.com"
+	AutoscalerVersion = "v1alpha1"
+	AutoscalerKind    = "MitoseAutoscaler"
+)
+
+var AutoscalerResource = schema.GroupVersionResource{
+	Group:    AutoscalerGroup,
+	Version:  AutoscalerVersion,
+	Resource: "mitoseautoscalers",
+}
+
+// Autoscaler is a MitoseAutoscaler, its spec has the fields of a controller
+// config.
+type Autoscaler struct {
+	Namespace  string
+	Name       string
+	Generation int64
+	Spec       map[string]interface{}
+}
+
+// AutoscalerStatus reports the last execution of the controller of a
+// MitoseAutoscaler, fields left empty keep their previous value.
+type AutoscalerStatus struct {
+	ObservedGeneration int64             `json:"observedGeneration"`
+	Metrics            map[string]string `json:"metrics,omitempty"`
+	DesiredReplicas    int               `json:"desiredReplicas"`
+	CurrentReplicas    *int              `json:"currentReplicas,omitempty"`
+	LastScaleTime      *metav1.Time      `json:"lastScaleTime,omitempty"`
+	Error              string            `json:"error"`
+}
+
+var (
+	autoscalersMu    = new(sync.Mutex)
+	autoscalerLister cache.GenericLister
+)
+
+// ListAutoscalers returns the MitoseAutoscalers of every namespace from the
+// informer of WatchAutoscalers, none until it is called or when the CRD isn't
+// installed.
+func ListAutoscalers() ([]Autoscaler, error) {
+	autoscalersMu.Lock()
+	lister := autoscalerLister
+	autoscalersMu.Unlock()
+	if lister == nil {
+		return nil, nil
+	}
+	items, err := lister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	autoscalers := make([]Autoscaler, 0, len(items))
+	for _, item := range items {
+		a, err := AutoscalerFromUnstructured(item.(*unstructured.Unstructured))
+		if err != nil {
+			return nil, err
+		}
+		autoscalers = append(autoscalers, a)
+	}
+	return autoscalers, nil
+}
+
+// AutoscalerFromUnstructured reads a MitoseAutoscaler object.
+func AutoscalerFromUnstructured(item *unstructured.Unstructured) (Autoscaler, error) {
+	spec, _, err := unstructured.NestedMap(item.Object, "spec")
+	if err != nil {
+		return Autoscaler{}, err
+	}
+	return Autoscaler{
+		Namespace:  item.GetNamespace(),
+		Name:       item.GetName(),
+		Generation: item.GetGeneration(),
+		Spec:       spec,
+	}, nil
+}
+
+// Config is the spec of a as a controller config, its target is always on
+// the namespace of the object. Its cluster and kind can't be changed either,
+// the controller package rejects those fields on namespaced entries.
+func (a Autoscaler) Config() (string, error) {
+	spec := make(map[string]interface{}, len(a.Spec)+1)
+	for k, v := range a.Spec {
+		spec[k] = v
+	}
+	spec["namespace"] = a.Namespace
+	v, err := json.Marshal(spec)
+	return string(v), err
+}
+
+// WatchAutoscalers notifies every MitoseAutoscaler created, deleted or with a
+// new spec until ctx is done, status updates are ignored. Like
+// WatchConfigMap it is an informer, the one read by ListAutoscalers, and the
+// channel is nil when the CRD isn't installed.
+func WatchAutoscalers(ctx context.Context) (<-chan struct{}, error) {
+	if err := checkAutoscalerCRD(ctx); apierrors.IsNotFound(err) {
+		autoscalersMu.Lock()
+		autoscalerLister = nil
+		autoscalersMu.Unlock()
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	dc, err := DynamicClientBuilder("")
+	if err != nil {
+		return nil, err
+	}
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(dc, informerResyncPeriod)
+	autoscalers := factory.ForResource(AutoscalerResource)
+	informer := autoscalers.Informer()
+	informer.SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+		log.Println("error watching mitoseautoscalers:", err)
+	})
+
+	c := make(chan struct{}, 1)
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(interface{}) { notify(c) },
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldItem, newItem := oldObj.(*unstructured.Unstructured), newObj.(*unstructured.Unstructured)
+			if oldItem.GetGeneration() == newItem.GetGeneration() {
+				return
+			}
+			notify(c)
+		},
+		DeleteFunc: func(interface{}) { notify(c) },
+	})
+	factory.Start(ctx.Done())
+
+	// a partial list would stop the controllers of the missing objects
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return nil, ctx.Err()
+	}
+	autoscalersMu.Lock()
+	autoscalerLister = autoscalers.Lister()
+	autoscalersMu.Unlock()
+	return c, nil
+}
+
+// UpdateAutoscalerStatus patches the status subresource of a MitoseAutoscaler.
+func UpdateAutoscalerStatus(ctx context.Context, namespace, name string, status AutoscalerStatus) error {
+	dc, err := DynamicClientBuilder("")
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{"status": status})
+	if err != nil {
+		return err
+	}
+	_, err = dc.Resource(AutoscalerResource).Namespace(namespace).Patch(
+		ctx,
+		name,
+		types.MergePatchType,
+		patch,
+		metav1.PatchOptions{},
+		"status",
+	)
+	return err
+}
+
+// checkAutoscalerCRD returns a NotFound error when the CRD isn't installed.
+func checkAutoscalerCRD(ctx context.Context) error {
+	dc, err := DynamicClientBuilder("")
+	if err != nil {
+		return err
+	}
+	_, err = dc.Resource(AutoscalerResource).List(ctx, metav1.ListOptions{Limit: 1})
+	return err
+}
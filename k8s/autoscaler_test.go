@@ -0,0 +1,156 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func fakeAutoscaler(namespace, name string, generation int64, spec map[string]interface{}) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	u.SetAPIVersion(AutoscalerGroup + "/" + AutoscalerVersion)
+	u.SetKind(AutoscalerKind)
+	u.SetNamespace(namespace)
+	u.SetName(name)
+	u.SetUID(types.UID("uid-" + name))
+	u.SetGeneration(generation)
+	return u
+}
+
+func fakeDynamicClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	dc := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{AutoscalerResource: AutoscalerKind + "List"},
+		objects...,
+	)
+	DynamicClientBuilder = func(string) (dynamic.Interface, error) { return dc, nil }
+	return dc
+}
+
+func TestListAutoscalers(t *testing.T) {
+	dc := fakeDynamicClient(
+		fakeAutoscaler("fakeNS", "fakeAutoscaler", 2, map[string]interface{}{"type": "sqs", "deployment": "fakeDeploy"}),
+	)
+	defer func() { DynamicClientBuilder = concretDynamicBuilder }()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := WatchAutoscalers(ctx); err != nil {
+		t.Fatal("error watching autoscalers", err)
+	}
+	actions := len(dc.Actions())
+	autoscalers, err := ListAutoscalers()
+	if err != nil {
+		t.Fatal("error listing autoscalers", err)
+	}
+	if len(dc.Actions()) != actions {
+		t.Errorf("expected autoscalers to be read from the informer, got %v", dc.Actions()[actions:])
+	}
+	if len(autoscalers) != 1 {
+		t.Fatalf("expected 1 autoscaler, got %d", len(autoscalers))
+	}
+	a := autoscalers[0]
+	if a.Namespace != "fakeNS" || a.Name != "fakeAutoscaler" || a.Generation != 2 {
+		t.Errorf("unexpected autoscaler %+v", a)
+	}
+	if a.Spec["deployment"] != "fakeDeploy" {
+		t.Errorf("expected deployment fakeDeploy on spec, got %v", a.Spec)
+	}
+}
+
+func TestListAutoscalersWithoutCRD(t *testing.T) {
+	dc := fakeDynamicClient()
+	defer func() { DynamicClientBuilder = concretDynamicBuilder }()
+	dc.PrependReactor("list", "mitoseautoscalers", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewNotFound(AutoscalerResource.GroupResource(), "")
+	})
+
+	watcher, err := WatchAutoscalers(context.Background())
+	if err != nil || watcher != nil {
+		t.Errorf("expected nil watcher and no error, got %v and %v", watcher, err)
+	}
+	autoscalers, err := ListAutoscalers()
+	if err != nil || len(autoscalers) != 0 {
+		t.Errorf("expected no autoscalers and no error, got %v and %v", autoscalers, err)
+	}
+}
+
+func TestUpdateAutoscalerStatus(t *testing.T) {
+	dc := fakeDynamicClient(fakeAutoscaler("fakeNS", "fakeAutoscaler", 1, map[string]interface{}{"type": "sqs"}))
+	defer func() { DynamicClientBuilder = concretDynamicBuilder }()
+
+	current := 3
+	status := AutoscalerStatus{
+		ObservedGeneration: 1,
+		Metrics:            map[string]string{"msgsInQueue": "10"},
+		DesiredReplicas:    5,
+		CurrentReplicas:    &current,
+		Error:              "fake error",
+	}
+	if err := UpdateAutoscalerStatus(context.Background(), "fakeNS", "fakeAutoscaler", status); err != nil {
+		t.Fatal("error updating status", err)
+	}
+
+	u, err := dc.Resource(AutoscalerResource).Namespace("fakeNS").Get(context.Background(), "fakeAutoscaler", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal("error getting autoscaler", err)
+	}
+	desired, _, _ := unstructured.NestedInt64(u.Object, "status", "desiredReplicas")
+	msgs, _, _ := unstructured.NestedString(u.Object, "status", "metrics", "msgsInQueue")
+	statusErr, _, _ := unstructured.NestedString(u.Object, "status", "error")
+	if desired != 5 || msgs != "10" || statusErr != "fake error" {
+		t.Errorf("unexpected status %v", u.Object["status"])
+	}
+	if _, found := u.Object["status"].(map[string]interface{})["lastScaleTime"]; found {
+		t.Error("expected no lastScaleTime on status")
+	}
+}
+
+func TestWatchAutoscalers(t *testing.T) {
+	autoscaler := fakeAutoscaler("fakeNS", "fakeAutoscaler", 1, map[string]interface{}{"type": "sqs"})
+	dc := fakeDynamicClient(autoscaler)
+	defer func() { DynamicClientBuilder = concretDynamicBuilder }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watcher, err := WatchAutoscalers(ctx)
+	if err != nil {
+		t.Fatal("error watching autoscalers", err)
+	}
+	resource := dc.Resource(AutoscalerResource).Namespace("fakeNS")
+	select {
+	case <-watcher:
+	case <-time.After(time.Second):
+		t.Fatal("expected notification of the existing autoscaler")
+	}
+
+	autoscaler.Object["status"] = map[string]interface{}{"desiredReplicas": int64(2)}
+	if _, err := resource.Update(ctx, autoscaler, metav1.UpdateOptions{}); err != nil {
+		t.Fatal("error updating autoscaler", err)
+	}
+	select {
+	case <-watcher:
+		t.Fatal("expected status update to be ignored")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	autoscaler.SetGeneration(2)
+	if _, err := resource.Update(ctx, autoscaler, metav1.UpdateOptions{}); err != nil {
+		t.Fatal("error updating autoscaler", err)
+	}
+	select {
+	case <-watcher:
+	case <-time.After(time.Second):
+		t.Fatal("expected spec update to be notified")
+	}
+}
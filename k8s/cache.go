@@ -0,0 +1,244 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/scale"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	informerResyncPeriod = 10 * time.Minute
+	informerSyncTimeout  = 30 * time.Second
+)
+
+type informerKey struct {
+	kc        kubernetes.Interface
+	namespace string
+}
+
+var (
+	clientsMu = new(sync.Mutex)
+	clients   = make(map[string]kubernetes.Interface)
+
+	dynamicClientsMu = new(sync.Mutex)
+	dynamicClients   = make(map[string]dynamic.Interface)
+
+	servedGroupsMu = new(sync.Mutex)
+	servedGroups   = make(map[kubernetes.Interface]map[string]bool)
+
+	scaleClientsMu = new(sync.Mutex)
+	scaleClients   = make(map[kubernetes.Interface]*scaleClient)
+
+	informersMu      = new(sync.Mutex)
+	deploymentCaches = make(map[informerKey]*deploymentCache)
+)
+
+// concretBuilder shares one client for each cluster.
+func concretBuilder(cluster string) (kubernetes.Interface, error) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if kc, found := clients[cluster]; found {
+		return kc, nil
+	}
+	kc, err := newClient(cluster)
+	if err != nil {
+		return nil, err
+	}
+	clients[cluster] = kc
+	return kc, nil
+}
+
+// concretDynamicBuilder shares one dynamic client for each cluster.
+func concretDynamicBuilder(cluster string) (dynamic.Interface, error) {
+	dynamicClientsMu.Lock()
+	defer dynamicClientsMu.Unlock()
+	if dc, found := dynamicClients[cluster]; found {
+		return dc, nil
+	}
+	k8sConfig, err := restConfig(cluster)
+	if err != nil {
+		return nil, err
+	}
+	dc, err := dynamic.NewForConfig(k8sConfig)
+	if err != nil {
+		return nil, err
+	}
+	dynamicClients[cluster] = dc
+	return dc, nil
+}
+
+// servedGroupVersions is discovered once for each client, a restart is needed
+// to notice a cluster upgrade.
+func servedGroupVersions(kc kubernetes.Interface) (map[string]bool, error) {
+	servedGroupsMu.Lock()
+	defer servedGroupsMu.Unlock()
+	if served, found := servedGroups[kc]; found {
+		return served, nil
+	}
+	groups, err := kc.Discovery().ServerGroups()
+	if err != nil {
+		return nil, err
+	}
+	served := make(map[string]bool)
+	for _, g := range groups.Groups {
+		for _, v := range g.Versions {
+			served[v.GroupVersion] = true
+		}
+	}
+	servedGroups[kc] = served
+	return served, nil
+}
+
+// getScaleClient shares one scaleClient, with its discovery cache, for each
+// client.
+func getScaleClient(kc kubernetes.Interface) *scaleClient {
+	scaleClientsMu.Lock()
+	defer scaleClientsMu.Unlock()
+	if sc, found := scaleClients[kc]; found {
+		return sc
+	}
+	cached := memory.NewMemCacheClient(kc.Discovery())
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(cached)
+	sc := &scaleClient{
+		scales:    scale.New(ScaleRESTClient(kc), mapper, dynamic.LegacyAPIPathResolverFunc, scale.NewDiscoveryScaleKindResolver(cached)),
+		mapper:    mapper,
+		discovery: cached,
+	}
+	scaleClients[kc] = sc
+	return sc
+}
+
+// getDeployment reads the apps/v1 deployment from a shared informer, the one
+// of all namespaces when WatchAnnotatedDeployments runs or else the one of its
+// namespace started on first use, unless cached is false.
+func getDeployment(ctx context.Context, kc kubernetes.Interface, namespace, name string, cached bool) (*appsv1.Deployment, error) {
+	if !cached {
+		return kc.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	}
+	c, err := getDeploymentCache(ctx, kc, namespace)
+	if err != nil {
+		return nil, err
+	}
+	deployYaml, err := c.lister.Deployments(namespace).Get(name)
+	if err != nil {
+		return nil, err
+	}
+	// objects of the cache are shared, callers get a copy
+	return deployYaml.DeepCopy(), nil
+}
+
+// deploymentCache is the informer of the deployments of a namespace, synced
+// is closed once its lister can be read or err is set.
+type deploymentCache struct {
+	lister   appslisters.DeploymentLister
+	synced   chan struct{}
+	err      error
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func (c *deploymentCache) close() {
+	c.stopOnce.Do(func() { close(c.stop) })
+}
+
+// getDeploymentCache waits for the informer of namespace without holding
+// informersMu, so a namespace slow to sync doesn't block the others. A
+// failed sync is retried by the next read.
+func getDeploymentCache(ctx context.Context, kc kubernetes.Interface, namespace string) (*deploymentCache, error) {
+	key := informerKey{kc: kc, namespace: namespace}
+	informersMu.Lock()
+	c, found := deploymentCaches[informerKey{kc: kc}]
+	if found {
+		key = informerKey{kc: kc}
+	} else {
+		c, found = deploymentCaches[key]
+	}
+	if !found {
+		c = startDeploymentCache(kc, namespace)
+		deploymentCaches[key] = c
+	}
+	informersMu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.synced:
+	}
+	if c.err != nil {
+		informersMu.Lock()
+		if deploymentCaches[key] == c {
+			delete(deploymentCaches, key)
+		}
+		informersMu.Unlock()
+		return nil, c.err
+	}
+	return c, nil
+}
+
+func startDeploymentCache(kc kubernetes.Interface, namespace string) *deploymentCache {
+	factory := informers.NewSharedInformerFactoryWithOptions(kc, informerResyncPeriod, informers.WithNamespace(namespace))
+	deployments := factory.Apps().V1().Deployments()
+	c := &deploymentCache{
+		lister: deployments.Lister(),
+		synced: make(chan struct{}),
+		stop:   make(chan struct{}),
+	}
+	informer := deployments.Informer()
+	factory.Start(c.stop)
+
+	go func() {
+		defer close(c.synced)
+		ctx, cancel := context.WithTimeout(context.Background(), informerSyncTimeout)
+		defer cancel()
+		go func() {
+			select {
+			case <-c.stop:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+			c.err = fmt.Errorf("timeout syncing deployments of namespace %s", namespace)
+			c.close()
+		}
+	}()
+	return c
+}
+
+// shareDeploymentCache makes the synced informer of all namespaces the one
+// read for kc and stops the informers of each namespace it replaces.
+func shareDeploymentCache(kc kubernetes.Interface, shared *deploymentCache) {
+	informersMu.Lock()
+	defer informersMu.Unlock()
+	for key, c := range deploymentCaches {
+		if key.kc == kc {
+			c.close()
+			delete(deploymentCaches, key)
+		}
+	}
+	deploymentCaches[informerKey{kc: kc}] = shared
+}
+
+// stopInformers stops the deployment and secret informers, the next reads
+// start new ones.
+func stopInformers() {
+	StopUnusedSecretInformers(func(string, string) bool { return false })
+	informersMu.Lock()
+	defer informersMu.Unlock()
+	for key, c := range deploymentCaches {
+		c.close()
+		delete(deploymentCaches, key)
+	}
+}
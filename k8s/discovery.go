@@ -0,0 +1,165 @@
+package k8s
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// AnnotationPrefix is the prefix of the annotations read by mitose.
+	AnnotationPrefix = "mitose.luizalabs.com/"
+	// TypeAnnotation marks the deployments configured by their annotations.
+	TypeAnnotation = AnnotationPrefix + "type"
+)
+
+// AnnotatedDeployment is a deployment with the TypeAnnotation, its mitose
+// annotations have the fields of a controller config.
+type AnnotatedDeployment struct {
+	Namespace   string
+	Name        string
+	Annotations map[string]string
+}
+
+var (
+	annotatedMu     = new(sync.Mutex)
+	annotatedLister appslisters.DeploymentLister
+)
+
+// WatchAnnotatedDeployments notifies every deployment of any namespace
+// annotated, deleted or with new mitose annotations until ctx is done. Like
+// WatchAutoscalers it is an informer, the one read by
+// ListAnnotatedDeployments and, in place of the informers of each namespace,
+// by the cached reads of deployments.
+func WatchAnnotatedDeployments(ctx context.Context) (<-chan struct{}, error) {
+	kc, err := ClientBuilder("")
+	if err != nil {
+		return nil, err
+	}
+	factory := informers.NewSharedInformerFactory(kc, informerResyncPeriod)
+	deployments := factory.Apps().V1().Deployments()
+	informer := deployments.Informer()
+	informer.SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+		log.Println("error watching annotated deployments:", err)
+	})
+
+	c := make(chan struct{}, 1)
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if isAnnotated(obj.(*appsv1.Deployment)) {
+				notify(c)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldDeploy, newDeploy := oldObj.(*appsv1.Deployment), newObj.(*appsv1.Deployment)
+			if !reflect.DeepEqual(mitoseAnnotations(oldDeploy), mitoseAnnotations(newDeploy)) {
+				notify(c)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if deploy, ok := obj.(*appsv1.Deployment); !ok || isAnnotated(deploy) {
+				notify(c)
+			}
+		},
+	})
+	shared := &deploymentCache{
+		lister: deployments.Lister(),
+		synced: make(chan struct{}),
+		stop:   make(chan struct{}),
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			shared.close()
+		case <-shared.stop:
+		}
+	}()
+	factory.Start(shared.stop)
+
+	// the deployments of a large cluster may take longer than
+	// informerSyncTimeout, the wait goes on until ctx is done
+	for {
+		syncCtx, cancel := context.WithTimeout(ctx, informerSyncTimeout)
+		synced := cache.WaitForCacheSync(syncCtx.Done(), informer.HasSynced)
+		cancel()
+		if synced {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			shared.close()
+			return nil, err
+		}
+		log.Println("still syncing the deployments of every namespace")
+	}
+	close(shared.synced)
+	shareDeploymentCache(kc, shared)
+	annotatedMu.Lock()
+	annotatedLister = deployments.Lister()
+	annotatedMu.Unlock()
+	return c, nil
+}
+
+// ListAnnotatedDeployments returns the deployments with the TypeAnnotation,
+// none until WatchAnnotatedDeployments is called.
+func ListAnnotatedDeployments() ([]AnnotatedDeployment, error) {
+	annotatedMu.Lock()
+	lister := annotatedLister
+	annotatedMu.Unlock()
+	if lister == nil {
+		return nil, nil
+	}
+	deployments, err := lister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	annotated := make([]AnnotatedDeployment, 0)
+	for _, deploy := range deployments {
+		if !isAnnotated(deploy) {
+			continue
+		}
+		annotated = append(annotated, AnnotatedDeployment{
+			Namespace:   deploy.Namespace,
+			Name:        deploy.Name,
+			Annotations: mitoseAnnotations(deploy),
+		})
+	}
+	sort.Slice(annotated, func(i, j int) bool {
+		if annotated[i].Namespace != annotated[j].Namespace {
+			return annotated[i].Namespace < annotated[j].Namespace
+		}
+		return annotated[i].Name < annotated[j].Name
+	})
+	return annotated, nil
+}
+
+func isAnnotated(deploy *appsv1.Deployment) bool {
+	_, found := deploy.Annotations[TypeAnnotation]
+	return found
+}
+
+// mitoseAnnotations copies the annotations with AnnotationPrefix, the ones of
+// deployments without the TypeAnnotation are ignored.
+func mitoseAnnotations(deploy *appsv1.Deployment) map[string]string {
+	annotations := make(map[string]string)
+	if !isAnnotated(deploy) {
+		return annotations
+	}
+	for k, v := range deploy.Annotations {
+		if strings.HasPrefix(k, AnnotationPrefix) {
+			annotations[k] = v
+		}
+	}
+	return annotations
+}
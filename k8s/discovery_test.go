@@ -0,0 +1,79 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func fakeDeployment(namespace, name string, annotations map[string]string) *appsv1.Deployment {
+	deploy := &appsv1.Deployment{}
+	deploy.Namespace = namespace
+	deploy.Name = name
+	deploy.Annotations = annotations
+	return deploy
+}
+
+func TestWatchAnnotatedDeployments(t *testing.T) {
+	annotated := fakeDeployment("team", "worker", map[string]string{
+		TypeAnnotation:                      "sqs",
+		AnnotationPrefix + "max":            "20",
+		"deployment.kubernetes.io/revision": "1",
+	})
+	fakeK8sClient = fake.NewSimpleClientset(annotated, fakeDeployment("other", "api", nil))
+	ClientBuilder = fakeBuilder
+	defer func() { ClientBuilder = concretBuilder }()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c, err := WatchAnnotatedDeployments(ctx)
+	if err != nil {
+		t.Fatal("error watching annotated deployments", err)
+	}
+	deployments, err := ListAnnotatedDeployments()
+	if err != nil {
+		t.Fatal("error listing annotated deployments", err)
+	}
+	if len(deployments) != 1 || deployments[0].Namespace != "team" || deployments[0].Name != "worker" {
+		t.Fatalf("expected annotated deployment only, got %+v", deployments)
+	}
+	if len(deployments[0].Annotations) != 2 {
+		t.Errorf("expected mitose annotations only, got %v", deployments[0].Annotations)
+	}
+	<-c
+
+	if _, err := getDeployment(ctx, fakeK8sClient, "other", "api", true); err != nil {
+		t.Fatal("error reading deployment from the cache", err)
+	}
+	if _, found := deploymentCaches[informerKey{kc: fakeK8sClient}]; !found || len(deploymentCaches) != 1 {
+		t.Errorf("expected deployments to be read from the informer of all namespaces, got %v", deploymentCaches)
+	}
+	defer stopInformers()
+
+	unrelated := fakeDeployment("other", "api", map[string]string{"foo": "bar"})
+	if _, err := fakeK8sClient.AppsV1().Deployments("other").Update(ctx, unrelated, metav1.UpdateOptions{}); err != nil {
+		t.Fatal("error updating deployment", err)
+	}
+	annotated.Annotations[AnnotationPrefix+"max"] = "30"
+	if _, err := fakeK8sClient.AppsV1().Deployments("team").Update(ctx, annotated, metav1.UpdateOptions{}); err != nil {
+		t.Fatal("error updating deployment", err)
+	}
+	select {
+	case <-c:
+	case <-time.After(time.Second):
+		t.Fatal("expected notification of annotations change")
+	}
+
+	if err := fakeK8sClient.AppsV1().Deployments("team").Delete(ctx, "worker", metav1.DeleteOptions{}); err != nil {
+		t.Fatal("error deleting deployment", err)
+	}
+	select {
+	case <-c:
+	case <-time.After(time.Second):
+		t.Fatal("expected notification of annotated deployment deletion")
+	}
+}
@@ -0,0 +1,217 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	JobKind     = "Job"
+	CronJobKind = "CronJob"
+
+	// JobTemplateLabel marks the jobs launched by mitose with the name of their template.
+	JobTemplateLabel = "mitose.luizalabs.com/job-template"
+
+	batchV1      = "batch/v1"
+	batchV1beta1 = "batch/v1beta1"
+
+	maxJobNameLength = 63
+	jobSuffixLength  = 5
+
+	// finished jobs are kept for a day, so their logs can be read, unless the
+	// template sets its own ttlSecondsAfterFinished
+	jobTTLSecondsAfterFinished = int32(24 * 60 * 60)
+)
+
+// labels set by the job controller, they can't be copied to new jobs
+var jobControllerLabels = []string{
+	"controller-uid",
+	"job-name",
+	"batch.kubernetes.io/controller-uid",
+	"batch.kubernetes.io/job-name",
+}
+
+// IsJobKind reports if kind is scaled by launching jobs instead of replicas.
+func IsJobKind(kind string) bool {
+	return kind == JobKind || kind == CronJobKind
+}
+
+// ScaleJobs launches jobs from the template of t (a Job or the jobTemplate
+// of a CronJob) until the unfinished jobs launched from it reach desiredJobs.
+// Jobs are never deleted, finished ones are removed by the TTL controller.
+func ScaleJobs(ctx context.Context, t Target, desiredJobs int) error {
+	kc, err := ClientBuilder(t.Cluster)
+	if err != nil {
+		return err
+	}
+	activeJobs, err := countActiveJobs(ctx, kc, t)
+	if err != nil {
+		return err
+	}
+	if activeJobs >= desiredJobs {
+		return nil
+	}
+
+	template, err := jobTemplate(ctx, kc, t)
+	if err != nil {
+		return err
+	}
+	for i := activeJobs; i < desiredJobs; i++ {
+		job := newJob(t, template)
+		if _, err := kc.BatchV1().Jobs(t.Namespace).Create(ctx, job, metav1.CreateOptions{}); err != nil {
+			return err
+		}
+		log.Printf("job %s launched for %s\n", job.Name, t)
+	}
+	return nil
+}
+
+// GetActiveJobsCount returns the number of unfinished jobs launched from t.
+func GetActiveJobsCount(ctx context.Context, t Target) (int, error) {
+	kc, err := ClientBuilder(t.Cluster)
+	if err != nil {
+		return -1, err
+	}
+	return countActiveJobs(ctx, kc, t)
+}
+
+func countActiveJobs(ctx context.Context, kc kubernetes.Interface, t Target) (int, error) {
+	jobs, err := listJobs(ctx, kc, t)
+	if err != nil {
+		return -1, err
+	}
+	active := 0
+	for _, job := range jobs {
+		if !jobFinished(job) {
+			active++
+		}
+	}
+	return active, nil
+}
+
+func listJobs(ctx context.Context, kc kubernetes.Interface, t Target) ([]batchv1.Job, error) {
+	jobList, err := kc.BatchV1().Jobs(t.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", JobTemplateLabel, t.Name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobList.Items, nil
+}
+
+func jobFinished(job batchv1.Job) bool {
+	for _, c := range job.Status.Conditions {
+		if (c.Type == batchv1.JobComplete || c.Type == batchv1.JobFailed) && c.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+func getJobTemplateAnnotations(ctx context.Context, t Target) (map[string]string, error) {
+	kc, err := ClientBuilder(t.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	if t.Kind != CronJobKind {
+		job, err := kc.BatchV1().Jobs(t.Namespace).Get(ctx, t.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return job.Annotations, nil
+	}
+	version, err := servedVersion(kc, batchV1, batchV1beta1)
+	if err != nil {
+		return nil, err
+	}
+	if version == batchV1 {
+		cronJob, err := kc.BatchV1().CronJobs(t.Namespace).Get(ctx, t.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return cronJob.Annotations, nil
+	}
+	cronJob, err := kc.BatchV1beta1().CronJobs(t.Namespace).Get(ctx, t.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return cronJob.Annotations, nil
+}
+
+func jobTemplate(ctx context.Context, kc kubernetes.Interface, t Target) (*batchv1.JobTemplateSpec, error) {
+	if t.Kind != CronJobKind {
+		job, err := kc.BatchV1().Jobs(t.Namespace).Get(ctx, t.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		template := &batchv1.JobTemplateSpec{Spec: job.Spec}
+		template.Labels = job.Labels
+		template.Annotations = job.Annotations
+		return template, nil
+	}
+
+	version, err := servedVersion(kc, batchV1, batchV1beta1)
+	if err != nil {
+		return nil, err
+	}
+	if version == batchV1 {
+		cronJob, err := kc.BatchV1().CronJobs(t.Namespace).Get(ctx, t.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return &cronJob.Spec.JobTemplate, nil
+	}
+	cronJob, err := kc.BatchV1beta1().CronJobs(t.Namespace).Get(ctx, t.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	template := &batchv1.JobTemplateSpec{Spec: cronJob.Spec.JobTemplate.Spec}
+	template.Labels = cronJob.Spec.JobTemplate.Labels
+	template.Annotations = cronJob.Spec.JobTemplate.Annotations
+	return template, nil
+}
+
+// newJob copies template without the selector and labels generated by the
+// job controller for the template job, and without suspend, which keeps a
+// template Job from running.
+func newJob(t Target, template *batchv1.JobTemplateSpec) *batchv1.Job {
+	prefix := t.Name
+	if len(prefix) > maxJobNameLength-jobSuffixLength-1 {
+		prefix = prefix[:maxJobNameLength-jobSuffixLength-1]
+	}
+
+	job := &batchv1.Job{Spec: *template.Spec.DeepCopy()}
+	job.Name = fmt.Sprintf("%s-%s", prefix, utilrand.String(jobSuffixLength))
+	job.Namespace = t.Namespace
+	job.Annotations = copyStringMap(template.Annotations)
+	job.Labels = copyStringMap(template.Labels)
+	job.Labels[JobTemplateLabel] = t.Name
+
+	job.Spec.Selector = nil
+	job.Spec.ManualSelector = nil
+	job.Spec.Suspend = nil
+	if job.Spec.TTLSecondsAfterFinished == nil {
+		ttl := jobTTLSecondsAfterFinished
+		job.Spec.TTLSecondsAfterFinished = &ttl
+	}
+	for _, label := range jobControllerLabels {
+		delete(job.Labels, label)
+		delete(job.Spec.Template.Labels, label)
+	}
+	return job
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,114 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func fakeJob(name string, labels map[string]string, finished bool) *batchv1.Job {
+	job := &batchv1.Job{}
+	job.Name = name
+	job.Namespace = "fakeNS"
+	job.Labels = labels
+	if finished {
+		job.Status.Conditions = []batchv1.JobCondition{
+			{Type: batchv1.JobComplete, Status: corev1.ConditionTrue},
+		}
+	}
+	return job
+}
+
+func TestScaleJobs(t *testing.T) {
+	template := fakeJob("transcode", map[string]string{"app": "transcode", "controller-uid": "abc"}, true)
+	template.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"controller-uid": "abc"}}
+	template.Spec.Template.Labels = map[string]string{"app": "transcode", "controller-uid": "abc", "job-name": "transcode"}
+	suspend := true
+	template.Spec.Suspend = &suspend
+
+	launched := map[string]string{JobTemplateLabel: "transcode"}
+	fakeK8sClient = fake.NewSimpleClientset(
+		template,
+		fakeJob("transcode-done1", launched, true),
+		fakeJob("transcode-run01", launched, false),
+	)
+	ClientBuilder = fakeBuilder
+	defer func() { ClientBuilder = concretBuilder }()
+
+	target := Target{Namespace: "fakeNS", Name: "transcode", Kind: JobKind}
+	expectedJobs := 3
+	if err := ScaleJobs(context.Background(), target, expectedJobs); err != nil {
+		t.Fatal("error scaling jobs", err)
+	}
+
+	active, err := GetActiveJobsCount(context.Background(), target)
+	if err != nil {
+		t.Fatal("error getting active jobs", err)
+	}
+	if active != expectedJobs {
+		t.Errorf("expected %d active jobs, got %d", expectedJobs, active)
+	}
+
+	if _, err := fakeK8sClient.BatchV1().Jobs("fakeNS").Get(context.Background(), "transcode-done1", metav1.GetOptions{}); err != nil {
+		t.Error("expected finished job to be kept for the TTL controller", err)
+	}
+	jobs, err := listJobs(context.Background(), fakeK8sClient, target)
+	if err != nil {
+		t.Fatal("error listing jobs", err)
+	}
+	for _, job := range jobs {
+		if job.Name == "transcode-run01" || job.Name == "transcode-done1" {
+			continue
+		}
+		if job.Spec.Selector != nil {
+			t.Errorf("expected no selector on %s", job.Name)
+		}
+		if _, ok := job.Spec.Template.Labels["controller-uid"]; ok {
+			t.Errorf("expected no controller-uid label on %s", job.Name)
+		}
+		if job.Labels["app"] != "transcode" {
+			t.Errorf("expected label app=transcode on %s, got %v", job.Name, job.Labels)
+		}
+		if job.Spec.Suspend != nil {
+			t.Errorf("expected %s not to be suspended", job.Name)
+		}
+		if ttl := job.Spec.TTLSecondsAfterFinished; ttl == nil || *ttl != jobTTLSecondsAfterFinished {
+			t.Errorf("expected ttlSecondsAfterFinished on %s, got %v", job.Name, ttl)
+		}
+	}
+
+	if err := ScaleJobs(context.Background(), target, 1); err != nil {
+		t.Fatal("error scaling jobs", err)
+	}
+	if active, _ := GetActiveJobsCount(context.Background(), target); active != expectedJobs {
+		t.Errorf("expected running jobs to be kept, got %d active jobs", active)
+	}
+}
+
+func TestScaleJobsFromCronJob(t *testing.T) {
+	cronJob := &batchv1.CronJob{}
+	cronJob.Name = "report"
+	cronJob.Namespace = "fakeNS"
+	cronJob.Spec.JobTemplate.Labels = map[string]string{"app": "report"}
+	fakeK8sClient = fake.NewSimpleClientset(cronJob)
+	serveGroupVersions(batchV1)
+	ClientBuilder = fakeBuilder
+	defer func() { ClientBuilder = concretBuilder }()
+
+	target := Target{Namespace: "fakeNS", Name: "report", Kind: CronJobKind}
+	if err := ScaleJobs(context.Background(), target, 2); err != nil {
+		t.Fatal("error scaling jobs", err)
+	}
+
+	active, err := GetTargetReplicasCount(context.Background(), target)
+	if err != nil {
+		t.Fatal("error getting active jobs", err)
+	}
+	if active != 2 {
+		t.Errorf("expected 2 active jobs, got %d", active)
+	}
+}
@@ -1,104 +1,354 @@
 package k8s
 
 import (
-	"errors"
+	"context"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"log"
+	"os"
+	"reflect"
+	"strings"
 
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/retry"
 )
 
-const namespaceSecret = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+const (
+	namespaceSecret = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+	appsV1             = "apps/v1"
+	extensionsV1beta1  = "extensions/v1beta1"
+	autoscalingV2      = "autoscaling/v2"
+	autoscalingV2beta2 = "autoscaling/v2beta2"
+	autoscalingV1      = "autoscaling/v1"
+)
 
 var (
-	ClientBuilder func() (kubernetes.Interface, error) = concretBuilder
-	ReadFile      func(string) ([]byte, error)         = ioutil.ReadFile
+	ClientBuilder        func(cluster string) (kubernetes.Interface, error) = concretBuilder
+	DynamicClientBuilder func(cluster string) (dynamic.Interface, error)    = concretDynamicBuilder
+	ReadFile             func(string) ([]byte, error)                       = ioutil.ReadFile
 )
 
-func concretBuilder() (kubernetes.Interface, error) {
-	k8sConfig, err := restclient.InClusterConfig()
+// newClient uses the config of restConfig.
+func newClient(cluster string) (kubernetes.Interface, error) {
+	k8sConfig, err := restConfig(cluster)
 	if err != nil {
 		return nil, err
 	}
 	return kubernetes.NewForConfig(k8sConfig)
 }
 
+// restConfig is the in cluster config unless $KUBECONFIG is set, then
+// cluster is a context of the kubeconfig and empty means $KUBE_CONTEXT or
+// the current context.
+func restConfig(cluster string) (*restclient.Config, error) {
+	if os.Getenv("KUBECONFIG") == "" {
+		if cluster != "" {
+			return nil, fmt.Errorf("cluster %s requires $KUBECONFIG", cluster)
+		}
+		return restclient.InClusterConfig()
+	}
+	return kubeConfig(cluster).ClientConfig()
+}
+
+func kubeConfig(cluster string) clientcmd.ClientConfig {
+	if cluster == "" {
+		cluster = os.Getenv("KUBE_CONTEXT")
+	}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(),
+		&clientcmd.ConfigOverrides{CurrentContext: cluster},
+	)
+}
+
+// servedVersion returns the first of the group versions served by the cluster,
+// so the newest API is used without breaking older clusters.
+func servedVersion(kc kubernetes.Interface, groupVersions ...string) (string, error) {
+	served, err := servedGroupVersions(kc)
+	if err != nil {
+		return "", err
+	}
+	for _, gv := range groupVersions {
+		if served[gv] {
+			return gv, nil
+		}
+	}
+	return "", fmt.Errorf("none of %s is served by the cluster", strings.Join(groupVersions, ", "))
+}
+
 func GetConfigMapData(namespace, configmap string) (map[string]string, error) {
-	kc, err := ClientBuilder()
+	kc, err := ClientBuilder("")
 	if err != nil {
 		return nil, err
 	}
-	cm, err := kc.CoreV1().ConfigMaps(namespace).Get(configmap, metav1.GetOptions{})
+	cm, err := kc.CoreV1().ConfigMaps(namespace).Get(context.Background(), configmap, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
 	return cm.Data, nil
 }
 
-func UpdateHPA(namespace, name string, min, max int) error {
-	kc, err := ClientBuilder()
+func UpdateHPA(ctx context.Context, t Target, min, max int) error {
+	kc, err := ClientBuilder(t.Cluster)
 	if err != nil {
 		return err
 	}
-	hpaYaml, err := kc.AutoscalingV1().
-		HorizontalPodAutoscalers(namespace).
-		Get(name, metav1.GetOptions{})
+	version, err := servedVersion(kc, autoscalingV2, autoscalingV2beta2, autoscalingV1)
 	if err != nil {
 		return err
 	}
-	min32 := int32(min)
-	hpaYaml.Spec.MaxReplicas = int32(max)
-	hpaYaml.Spec.MinReplicas = &min32
 
-	_, err = kc.AutoscalingV1().HorizontalPodAutoscalers(namespace).Update(hpaYaml)
-	return err
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		currentMin, currentMax, resourceVersion, err := getHPABounds(ctx, kc, version, t.Namespace, t.Name)
+		if err != nil {
+			return err
+		}
+		if currentMin == min && currentMax == max {
+			return nil
+		}
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{"resourceVersion": resourceVersion},
+			"spec":     map[string]interface{}{"minReplicas": min, "maxReplicas": max},
+		})
+		if err != nil {
+			return err
+		}
+
+		switch version {
+		case autoscalingV2:
+			_, err = kc.AutoscalingV2().HorizontalPodAutoscalers(t.Namespace).
+				Patch(ctx, t.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+		case autoscalingV2beta2:
+			_, err = kc.AutoscalingV2beta2().HorizontalPodAutoscalers(t.Namespace).
+				Patch(ctx, t.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+		default:
+			_, err = kc.AutoscalingV1().HorizontalPodAutoscalers(t.Namespace).
+				Patch(ctx, t.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+		}
+		return err
+	})
+}
+
+func GetHPAAnnotations(ctx context.Context, t Target) (map[string]string, error) {
+	kc, err := ClientBuilder(t.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	hpaYaml, err := kc.AutoscalingV1().HorizontalPodAutoscalers(t.Namespace).Get(ctx, t.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return hpaYaml.Annotations, nil
+}
+
+// getHPABounds returns min 1 when the HPA has no minReplicas, like the API server.
+func getHPABounds(ctx context.Context, kc kubernetes.Interface, version, namespace, name string) (int, int, string, error) {
+	var (
+		minReplicas *int32
+		maxReplicas int32
+		meta        metav1.ObjectMeta
+	)
+	switch version {
+	case autoscalingV2:
+		hpaYaml, err := kc.AutoscalingV2().HorizontalPodAutoscalers(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return -1, -1, "", err
+		}
+		minReplicas, maxReplicas, meta = hpaYaml.Spec.MinReplicas, hpaYaml.Spec.MaxReplicas, hpaYaml.ObjectMeta
+	case autoscalingV2beta2:
+		hpaYaml, err := kc.AutoscalingV2beta2().HorizontalPodAutoscalers(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return -1, -1, "", err
+		}
+		minReplicas, maxReplicas, meta = hpaYaml.Spec.MinReplicas, hpaYaml.Spec.MaxReplicas, hpaYaml.ObjectMeta
+	default:
+		hpaYaml, err := kc.AutoscalingV1().HorizontalPodAutoscalers(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return -1, -1, "", err
+		}
+		minReplicas, maxReplicas, meta = hpaYaml.Spec.MinReplicas, hpaYaml.Spec.MaxReplicas, hpaYaml.ObjectMeta
+	}
+	min := 1
+	if minReplicas != nil {
+		min = int(*minReplicas)
+	}
+	return min, int(maxReplicas), meta.ResourceVersion, nil
 }
 
-func UpdateReplicasCount(namespace, deployment string, desiredReplicas int) error {
-	kc, err := ClientBuilder()
+// UpdateReplicasCount patches the scale subresource of the deployment, the
+// patch carries the resourceVersion read so concurrent changes are retried
+// instead of overwritten, and nothing is written when replicas already match.
+func UpdateReplicasCount(ctx context.Context, t Target, desiredReplicas int) error {
+	kc, err := ClientBuilder(t.Cluster)
 	if err != nil {
 		return err
 	}
-	deployYaml, err := kc.Extensions().
-		Deployments(namespace).
-		Get(deployment, metav1.GetOptions{})
+	version, err := servedVersion(kc, appsV1, extensionsV1beta1)
 	if err != nil {
 		return err
 	}
 
-	dp := int32(desiredReplicas)
-	deployYaml.Spec.Replicas = &dp
-	_, err = kc.Extensions().Deployments(namespace).Update(deployYaml)
-	return err
+	// after a conflict the cache may still be stale, so retries read the API
+	cached := true
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		replicas, resourceVersion, err := getDeploymentReplicas(ctx, kc, version, t.Namespace, t.Name, cached)
+		cached = false
+		if err != nil {
+			return err
+		}
+		if replicas == desiredReplicas {
+			return nil
+		}
+		patch, err := replicasPatch(resourceVersion, desiredReplicas)
+		if err != nil {
+			return err
+		}
+
+		if version == appsV1 {
+			_, err = kc.AppsV1().Deployments(t.Namespace).
+				Patch(ctx, t.Name, types.MergePatchType, patch, metav1.PatchOptions{}, "scale")
+		} else {
+			_, err = kc.ExtensionsV1beta1().Deployments(t.Namespace).
+				Patch(ctx, t.Name, types.MergePatchType, patch, metav1.PatchOptions{}, "scale")
+		}
+		return err
+	})
+}
+
+func GetReplicasCount(ctx context.Context, t Target) (int, error) {
+	kc, err := ClientBuilder(t.Cluster)
+	if err != nil {
+		return -1, err
+	}
+	version, err := servedVersion(kc, appsV1, extensionsV1beta1)
+	if err != nil {
+		return -1, err
+	}
+	replicas, _, err := getDeploymentReplicas(ctx, kc, version, t.Namespace, t.Name, true)
+	return replicas, err
 }
 
-func WatchConfigMap(namespace string) (<-chan error, error) {
-	kc, err := ClientBuilder()
+func GetDeploymentAnnotations(ctx context.Context, t Target) (map[string]string, error) {
+	kc, err := ClientBuilder(t.Cluster)
 	if err != nil {
 		return nil, err
 	}
-	watcher, err := kc.CoreV1().ConfigMaps(namespace).Watch(metav1.ListOptions{})
+	version, err := servedVersion(kc, appsV1, extensionsV1beta1)
 	if err != nil {
 		return nil, err
 	}
+	if version == appsV1 {
+		deployYaml, err := getDeployment(ctx, kc, t.Namespace, t.Name, true)
+		if err != nil {
+			return nil, err
+		}
+		return deployYaml.Annotations, nil
+	}
+	deployYaml, err := kc.ExtensionsV1beta1().Deployments(t.Namespace).Get(ctx, t.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return deployYaml.Annotations, nil
+}
 
-	c := make(chan error)
-	go func() {
-		defer close(c)
-		for e := range watcher.ResultChan() {
-			if e.Type == watch.Error {
-				c <- errors.New("error reading configmap")
-			} else {
-				c <- nil
-			}
+func getDeploymentReplicas(ctx context.Context, kc kubernetes.Interface, version, namespace, deployment string, cached bool) (int, string, error) {
+	var (
+		replicas *int32
+		meta     metav1.ObjectMeta
+	)
+	if version == appsV1 {
+		deployYaml, err := getDeployment(ctx, kc, namespace, deployment, cached)
+		if err != nil {
+			return -1, "", err
+		}
+		replicas, meta = deployYaml.Spec.Replicas, deployYaml.ObjectMeta
+	} else {
+		deployYaml, err := kc.ExtensionsV1beta1().
+			Deployments(namespace).
+			Get(ctx, deployment, metav1.GetOptions{})
+		if err != nil {
+			return -1, "", err
 		}
-	}()
+		replicas, meta = deployYaml.Spec.Replicas, deployYaml.ObjectMeta
+	}
+	if replicas == nil {
+		return 1, meta.ResourceVersion, nil
+	}
+	return int(*replicas), meta.ResourceVersion, nil
+}
+
+// replicasPatch is a merge patch of spec.replicas that fails with a conflict
+// if the object changed since resourceVersion was read.
+func replicasPatch(resourceVersion string, replicas int) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"resourceVersion": resourceVersion},
+		"spec":     map[string]interface{}{"replicas": replicas},
+	})
+}
+
+// WatchConfigMap notifies every change on the data of the configmap name,
+// until ctx is done. It is a field selected informer, so watches are resumed
+// (or the configmap listed again) after errors, and notifications are
+// coalesced while the receiver is busy.
+func WatchConfigMap(ctx context.Context, namespace, name string) (<-chan struct{}, error) {
+	kc, err := ClientBuilder("")
+	if err != nil {
+		return nil, err
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(
+		kc,
+		informerResyncPeriod,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}),
+	)
+	informer := factory.Core().V1().ConfigMaps().Informer()
+	informer.SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+		log.Printf("error watching configmap %s/%s: %s\n", namespace, name, err)
+	})
+
+	c := make(chan struct{}, 1)
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(interface{}) { notify(c) },
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldCM, newCM := oldObj.(*corev1.ConfigMap), newObj.(*corev1.ConfigMap)
+			if reflect.DeepEqual(oldCM.Data, newCM.Data) {
+				return
+			}
+			notify(c)
+		},
+		DeleteFunc: func(interface{}) { notify(c) },
+	})
+	factory.Start(ctx.Done())
 	return c, nil
 }
 
+// notify doesn't block, a pending notification already covers the change.
+func notify(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// GetCurrentNamespace returns the namespace of the kubeconfig context when
+// running out of the cluster.
 func GetCurrentNamespace() (string, error) {
+	if os.Getenv("KUBECONFIG") != "" {
+		ns, _, err := kubeConfig("").Namespace()
+		return ns, err
+	}
 	ns, err := ReadFile(namespaceSecret)
 	return string(ns), err
 }
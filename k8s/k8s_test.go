@@ -1,22 +1,46 @@
 package k8s
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	appsv1 "k8s.io/api/apps/v1"
+	hpa_apisv1 "k8s.io/api/autoscaling/v1"
+	hpa_apisv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/api/core/v1"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
-	"k8s.io/client-go/pkg/api/v1"
-	hpa_apisv1 "k8s.io/client-go/pkg/apis/autoscaling/v1"
-	v1beta1 "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	restclient "k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 var fakeK8sClient kubernetes.Interface
 
-func fakeBuilder() (kubernetes.Interface, error) {
+func fakeBuilder(string) (kubernetes.Interface, error) {
 	return fakeK8sClient, nil
 }
 
+func serveGroupVersions(groupVersions ...string) {
+	resources := make([]*metav1.APIResourceList, len(groupVersions))
+	for i, gv := range groupVersions {
+		resources[i] = &metav1.APIResourceList{GroupVersion: gv}
+	}
+	fakeK8sClient.(*fake.Clientset).Resources = resources
+}
+
 func TestGetCurrentNamespace(t *testing.T) {
 	expectedNS := "fakeNS"
 	fakeReadFile := func(string) ([]byte, error) {
@@ -33,6 +57,68 @@ func TestGetCurrentNamespace(t *testing.T) {
 	}
 }
 
+const fakeKubeConfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: blue
+  cluster: {server: "https://blue.example.com"}
+- name: green
+  cluster: {server: "https://green.example.com"}
+users:
+- name: mitose
+  user: {token: fake}
+contexts:
+- name: blue
+  context: {cluster: blue, user: mitose, namespace: mitose-blue}
+- name: green
+  context: {cluster: green, user: mitose, namespace: mitose-green}
+current-context: blue
+`
+
+func TestKubeConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mitose")
+	if err != nil {
+		t.Fatal("error creating temp dir", err)
+	}
+	defer os.RemoveAll(dir)
+	kubeconfig := filepath.Join(dir, "config")
+	if err := ioutil.WriteFile(kubeconfig, []byte(fakeKubeConfig), 0600); err != nil {
+		t.Fatal("error writing kubeconfig", err)
+	}
+	os.Setenv("KUBECONFIG", kubeconfig)
+	defer os.Unsetenv("KUBECONFIG")
+
+	ns, err := GetCurrentNamespace()
+	if err != nil {
+		t.Fatal("error getting current namespace", err)
+	}
+	if ns != "mitose-blue" {
+		t.Errorf("expected mitose-blue, got %s", ns)
+	}
+
+	os.Setenv("KUBE_CONTEXT", "green")
+	defer os.Unsetenv("KUBE_CONTEXT")
+	if ns, _ := GetCurrentNamespace(); ns != "mitose-green" {
+		t.Errorf("expected mitose-green, got %s", ns)
+	}
+
+	var testCases = []struct {
+		cluster     string
+		expectedErr bool
+	}{
+		{"", false},
+		{"blue", false},
+		{"green", false},
+		{"red", true},
+	}
+	for _, tc := range testCases {
+		_, err := concretBuilder(tc.cluster)
+		if (err != nil) != tc.expectedErr {
+			t.Errorf("cluster %q: expected error %t, got %v", tc.cluster, tc.expectedErr, err)
+		}
+	}
+}
+
 func TestK8sPkg(t *testing.T) {
 	var testFuncs = []struct {
 		name     string
@@ -40,7 +126,16 @@ func TestK8sPkg(t *testing.T) {
 	}{
 		{"TestGetConfigMapData", testGetConfigMapData},
 		{"TestUpdateHPA", testUpdateHPA},
+		{"TestUpdateHPAV1", testUpdateHPAV1},
 		{"TestUpdateReplicasCount", testUpdateReplicasCount},
+		{"TestUpdateReplicasCountExtensions", testUpdateReplicasCountExtensions},
+		{"TestUpdateReplicasCountConflict", testUpdateReplicasCountConflict},
+		{"TestUpdateReplicasCountUnchanged", testUpdateReplicasCountUnchanged},
+		{"TestGetReplicasCount", testGetReplicasCount},
+		{"TestGetReplicasCountCached", testGetReplicasCountCached},
+		{"TestGetDeploymentAnnotations", testGetDeploymentAnnotations},
+		{"TestSetPodDeletionCost", testSetPodDeletionCost},
+		{"TestUpdateTargetReplicasCount", testUpdateTargetReplicasCount},
 		{"TestWatchConfigMap", testWatchConfigMap},
 	}
 
@@ -48,6 +143,7 @@ func TestK8sPkg(t *testing.T) {
 
 	for _, tf := range testFuncs {
 		fakeK8sClient = fake.NewSimpleClientset()
+		serveGroupVersions(appsV1, autoscalingV2)
 		t.Run(tf.name, tf.testFunc)
 	}
 
@@ -61,7 +157,7 @@ func testGetConfigMapData(t *testing.T) {
 
 	fakeCM := &v1.ConfigMap{Data: map[string]string{expectedKey: expectedValue}}
 	fakeCM.Name = "fake"
-	if _, err := fakeK8sClient.CoreV1().ConfigMaps(fakeNS).Create(fakeCM); err != nil {
+	if _, err := fakeK8sClient.CoreV1().ConfigMaps(fakeNS).Create(context.Background(), fakeCM, metav1.CreateOptions{}); err != nil {
 		t.Fatal("error creating fake config map", err)
 	}
 
@@ -75,6 +171,43 @@ func testGetConfigMapData(t *testing.T) {
 }
 
 func testUpdateHPA(t *testing.T) {
+	fakeHPAName := "fakeHPA"
+	fakeNS := "fakeNS"
+	actualMin := int32(1)
+	fakeHPA := &hpa_apisv2.HorizontalPodAutoscaler{
+		Spec: hpa_apisv2.HorizontalPodAutoscalerSpec{
+			MaxReplicas: 1,
+			MinReplicas: &actualMin,
+		},
+	}
+	fakeHPA.Name = fakeHPAName
+
+	_, err := fakeK8sClient.AutoscalingV2().
+		HorizontalPodAutoscalers(fakeNS).
+		Create(context.Background(), fakeHPA, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal("error creating fake hpa", err)
+	}
+
+	expectedMaxReplicas := 2
+	if err := UpdateHPA(context.Background(), Target{Namespace: fakeNS, Name: fakeHPAName}, 2, expectedMaxReplicas); err != nil {
+		t.Fatal("error updating hpa", err)
+	}
+
+	hpa, err := fakeK8sClient.AutoscalingV2().
+		HorizontalPodAutoscalers(fakeNS).
+		Get(context.Background(), fakeHPAName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal("error getting fake hpa", err)
+	}
+
+	if hpa.Spec.MaxReplicas != int32(expectedMaxReplicas) {
+		t.Errorf("expected %d, got %d", expectedMaxReplicas, hpa.Spec.MaxReplicas)
+	}
+}
+
+func testUpdateHPAV1(t *testing.T) {
+	serveGroupVersions(appsV1, autoscalingV1)
 	fakeHPAName := "fakeHPA"
 	fakeNS := "fakeNS"
 	actualMin := int32(1)
@@ -88,19 +221,19 @@ func testUpdateHPA(t *testing.T) {
 
 	_, err := fakeK8sClient.AutoscalingV1().
 		HorizontalPodAutoscalers(fakeNS).
-		Create(fakeHPA)
+		Create(context.Background(), fakeHPA, metav1.CreateOptions{})
 	if err != nil {
 		t.Fatal("error creating fake hpa", err)
 	}
 
 	expectedMaxReplicas := 2
-	if err := UpdateHPA(fakeNS, fakeHPAName, 2, expectedMaxReplicas); err != nil {
+	if err := UpdateHPA(context.Background(), Target{Namespace: fakeNS, Name: fakeHPAName}, 2, expectedMaxReplicas); err != nil {
 		t.Fatal("error updating hpa", err)
 	}
 
 	hpa, err := fakeK8sClient.AutoscalingV1().
 		HorizontalPodAutoscalers(fakeNS).
-		Get(fakeHPAName, metav1.GetOptions{})
+		Get(context.Background(), fakeHPAName, metav1.GetOptions{})
 	if err != nil {
 		t.Fatal("error getting fake hpa", err)
 	}
@@ -111,6 +244,40 @@ func testUpdateHPA(t *testing.T) {
 }
 
 func testUpdateReplicasCount(t *testing.T) {
+	fakeNS := "fakeNS"
+	fakeDeployName := "fakeDeploy"
+	actualReplicas := int32(1)
+	fakeDeploy := &appsv1.Deployment{
+		Spec: appsv1.DeploymentSpec{Replicas: &actualReplicas},
+	}
+	fakeDeploy.Name = fakeDeployName
+
+	_, err := fakeK8sClient.AppsV1().
+		Deployments(fakeNS).
+		Create(context.Background(), fakeDeploy, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal("error creating fake deploy", err)
+	}
+
+	expectedReplicas := 2
+	if err := UpdateReplicasCount(context.Background(), Target{Namespace: fakeNS, Name: fakeDeployName}, expectedReplicas); err != nil {
+		t.Fatal("error updating replicas of fake deploy", err)
+	}
+
+	deploy, err := fakeK8sClient.AppsV1().
+		Deployments(fakeNS).
+		Get(context.Background(), fakeDeployName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal("error getting fake deploy", err)
+	}
+
+	if *deploy.Spec.Replicas != int32(expectedReplicas) {
+		t.Errorf("expected %d, got %d", expectedReplicas, *deploy.Spec.Replicas)
+	}
+}
+
+func testUpdateReplicasCountExtensions(t *testing.T) {
+	serveGroupVersions(extensionsV1beta1)
 	fakeNS := "fakeNS"
 	fakeDeployName := "fakeDeploy"
 	actualReplicas := int32(1)
@@ -119,21 +286,21 @@ func testUpdateReplicasCount(t *testing.T) {
 	}
 	fakeDeploy.Name = fakeDeployName
 
-	_, err := fakeK8sClient.Extensions().
+	_, err := fakeK8sClient.ExtensionsV1beta1().
 		Deployments(fakeNS).
-		Create(fakeDeploy)
+		Create(context.Background(), fakeDeploy, metav1.CreateOptions{})
 	if err != nil {
 		t.Fatal("error creating fake deploy", err)
 	}
 
 	expectedReplicas := 2
-	if err := UpdateReplicasCount(fakeNS, fakeDeployName, expectedReplicas); err != nil {
+	if err := UpdateReplicasCount(context.Background(), Target{Namespace: fakeNS, Name: fakeDeployName}, expectedReplicas); err != nil {
 		t.Fatal("error updating replicas of fake deploy", err)
 	}
 
-	deploy, err := fakeK8sClient.Extensions().
+	deploy, err := fakeK8sClient.ExtensionsV1beta1().
 		Deployments(fakeNS).
-		Get(fakeDeployName, metav1.GetOptions{})
+		Get(context.Background(), fakeDeployName, metav1.GetOptions{})
 	if err != nil {
 		t.Fatal("error getting fake deploy", err)
 	}
@@ -143,19 +310,319 @@ func testUpdateReplicasCount(t *testing.T) {
 	}
 }
 
-func testWatchConfigMap(t *testing.T) {
-	ClientBuilder = fakeBuilder
+func testUpdateReplicasCountConflict(t *testing.T) {
+	fakeNS := "fakeNS"
+	fakeDeployName := "fakeDeploy"
+	actualReplicas := int32(1)
+	fakeDeploy := &appsv1.Deployment{
+		Spec: appsv1.DeploymentSpec{Replicas: &actualReplicas},
+	}
+	fakeDeploy.Name = fakeDeployName
+	if _, err := fakeK8sClient.AppsV1().Deployments(fakeNS).Create(context.Background(), fakeDeploy, metav1.CreateOptions{}); err != nil {
+		t.Fatal("error creating fake deploy", err)
+	}
+
+	conflicts := 0
+	fakeK8sClient.(*fake.Clientset).PrependReactor("patch", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts > 0 {
+			return false, nil, nil
+		}
+		conflicts++
+		return true, nil, apierrors.NewConflict(appsv1.Resource("deployments"), fakeDeployName, errors.New("object was modified"))
+	})
+
+	expectedReplicas := 2
+	if err := UpdateReplicasCount(context.Background(), Target{Namespace: fakeNS, Name: fakeDeployName}, expectedReplicas); err != nil {
+		t.Fatal("error updating replicas of fake deploy", err)
+	}
+
+	deploy, err := fakeK8sClient.AppsV1().Deployments(fakeNS).Get(context.Background(), fakeDeployName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal("error getting fake deploy", err)
+	}
+	if *deploy.Spec.Replicas != int32(expectedReplicas) {
+		t.Errorf("expected %d, got %d", expectedReplicas, *deploy.Spec.Replicas)
+	}
+}
 
+func testUpdateReplicasCountUnchanged(t *testing.T) {
 	fakeNS := "fakeNS"
-	fakeName := "fake"
+	fakeDeployName := "fakeDeploy"
+	actualReplicas := int32(2)
+	fakeDeploy := &appsv1.Deployment{
+		Spec: appsv1.DeploymentSpec{Replicas: &actualReplicas},
+	}
+	fakeDeploy.Name = fakeDeployName
+	if _, err := fakeK8sClient.AppsV1().Deployments(fakeNS).Create(context.Background(), fakeDeploy, metav1.CreateOptions{}); err != nil {
+		t.Fatal("error creating fake deploy", err)
+	}
+
+	if err := UpdateReplicasCount(context.Background(), Target{Namespace: fakeNS, Name: fakeDeployName}, int(actualReplicas)); err != nil {
+		t.Fatal("error updating replicas of fake deploy", err)
+	}
+
+	for _, action := range fakeK8sClient.(*fake.Clientset).Actions() {
+		if action.GetVerb() == "patch" || action.GetVerb() == "update" {
+			t.Errorf("expected no writes, got %s", action.GetVerb())
+		}
+	}
+}
+
+func testGetReplicasCount(t *testing.T) {
+	fakeNS := "fakeNS"
+	fakeDeployName := "fakeDeploy"
+	expectedReplicas := int32(3)
+	fakeDeploy := &appsv1.Deployment{
+		Spec: appsv1.DeploymentSpec{Replicas: &expectedReplicas},
+	}
+	fakeDeploy.Name = fakeDeployName
 
-	fakeCM := &v1.ConfigMap{Data: map[string]string{}}
-	fakeCM.Name = fakeName
-	if _, err := fakeK8sClient.CoreV1().ConfigMaps(fakeNS).Create(fakeCM); err != nil {
+	_, err := fakeK8sClient.AppsV1().
+		Deployments(fakeNS).
+		Create(context.Background(), fakeDeploy, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal("error creating fake deploy", err)
+	}
+
+	replicas, err := GetReplicasCount(context.Background(), Target{Namespace: fakeNS, Name: fakeDeployName})
+	if err != nil {
+		t.Fatal("error getting replicas of fake deploy", err)
+	}
+
+	if replicas != int(expectedReplicas) {
+		t.Errorf("expected %d, got %d", expectedReplicas, replicas)
+	}
+}
+
+func testGetReplicasCountCached(t *testing.T) {
+	fakeNS := "fakeNS"
+	replicas := int32(2)
+	fakeDeploy := &appsv1.Deployment{Spec: appsv1.DeploymentSpec{Replicas: &replicas}}
+	fakeDeploy.Name = "fakeDeploy"
+	if _, err := fakeK8sClient.AppsV1().Deployments(fakeNS).Create(context.Background(), fakeDeploy, metav1.CreateOptions{}); err != nil {
+		t.Fatal("error creating fake deploy", err)
+	}
+
+	target := Target{Namespace: fakeNS, Name: fakeDeploy.Name}
+	for i := 0; i < 3; i++ {
+		actual, err := GetReplicasCount(context.Background(), target)
+		if err != nil {
+			t.Fatal("error getting replicas of fake deploy", err)
+		}
+		if actual != int(replicas) {
+			t.Errorf("expected %d, got %d", replicas, actual)
+		}
+	}
+
+	for _, action := range fakeK8sClient.(*fake.Clientset).Actions() {
+		if action.GetVerb() == "get" && action.GetResource().Resource == "deployments" {
+			t.Error("expected deployments to be read from the cache")
+		}
+	}
+
+	stopInformers()
+	if len(deploymentCaches) != 0 {
+		t.Errorf("expected informers to be stopped, got %d", len(deploymentCaches))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := GetReplicasCount(ctx, target); err != context.Canceled {
+		t.Errorf("expected the wait for the cache to end with the context, got %v", err)
+	}
+	stopInformers()
+}
+
+func testGetDeploymentAnnotations(t *testing.T) {
+	fakeNS := "fakeNS"
+	fakeDeploy := &appsv1.Deployment{}
+	fakeDeploy.Name = "fakeDeploy"
+	fakeDeploy.Annotations = map[string]string{"fakeKey": "fakeValue"}
+	if _, err := fakeK8sClient.AppsV1().Deployments(fakeNS).Create(context.Background(), fakeDeploy, metav1.CreateOptions{}); err != nil {
+		t.Fatal("error creating fake deploy", err)
+	}
+
+	annotations, err := GetTargetAnnotations(context.Background(), Target{Namespace: fakeNS, Name: fakeDeploy.Name})
+	if err != nil {
+		t.Fatal("error getting annotations of fake deploy", err)
+	}
+	if annotations["fakeKey"] != "fakeValue" {
+		t.Errorf("expected fakeValue, got %v", annotations)
+	}
+}
+
+func testSetPodDeletionCost(t *testing.T) {
+	fakeNS := "fakeNS"
+	fakeDeploy := &appsv1.Deployment{
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "worker"}},
+		},
+	}
+	fakeDeploy.Name = "fakeDeploy"
+	if _, err := fakeK8sClient.AppsV1().Deployments(fakeNS).Create(context.Background(), fakeDeploy, metav1.CreateOptions{}); err != nil {
+		t.Fatal("error creating fake deploy", err)
+	}
+	for _, name := range []string{"worker-1", "worker-2"} {
+		pod := &v1.Pod{Status: v1.PodStatus{Phase: v1.PodRunning}}
+		pod.Name = name
+		pod.Labels = map[string]string{"app": "worker"}
+		if _, err := fakeK8sClient.CoreV1().Pods(fakeNS).Create(context.Background(), pod, metav1.CreateOptions{}); err != nil {
+			t.Fatal("error creating fake pod", err)
+		}
+	}
+	other := &v1.Pod{Status: v1.PodStatus{Phase: v1.PodRunning}}
+	other.Name = "other"
+	if _, err := fakeK8sClient.CoreV1().Pods(fakeNS).Create(context.Background(), other, metav1.CreateOptions{}); err != nil {
+		t.Fatal("error creating fake pod", err)
+	}
+
+	pods, err := ListDeploymentPods(context.Background(), Target{Namespace: fakeNS, Name: fakeDeploy.Name})
+	if err != nil {
+		t.Fatal("error listing pods of fake deploy", err)
+	}
+	if len(pods) != 2 {
+		t.Fatalf("expected 2 pods, got %d", len(pods))
+	}
+
+	if err := SetPodDeletionCost(context.Background(), Target{Namespace: fakeNS, Name: fakeDeploy.Name}, pods[0], 5); err != nil {
+		t.Fatal("error setting pod deletion cost", err)
+	}
+	pod, err := fakeK8sClient.CoreV1().Pods(fakeNS).Get(context.Background(), pods[0].Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal("error getting fake pod", err)
+	}
+	if pod.Annotations[PodDeletionCostAnnotation] != "5" {
+		t.Errorf("expected cost 5, got %v", pod.Annotations)
+	}
+}
+
+func testUpdateTargetReplicasCount(t *testing.T) {
+	fakeNS := "fakeNS"
+	fakeName := "fakeSTS"
+	fakeK8sClient.(*fake.Clientset).Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "statefulsets", Kind: "StatefulSet", Namespaced: true},
+				{Name: "statefulsets/scale", Group: "autoscaling", Version: "v1", Kind: "Scale", Namespaced: true},
+			},
+		},
+	}
+
+	scale := map[string]interface{}{
+		"kind":       "Scale",
+		"apiVersion": "autoscaling/v1",
+		"metadata":   map[string]interface{}{"name": fakeName, "namespace": fakeNS},
+		"spec":       map[string]interface{}{"replicas": 1},
+	}
+	patches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/apps/v1/namespaces/fakeNS/statefulsets/fakeSTS/scale" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == http.MethodPatch {
+			patch := make(map[string]interface{})
+			if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			patches++
+			scale["spec"] = patch["spec"]
+		}
+		json.NewEncoder(w).Encode(scale)
+	}))
+	defer server.Close()
+
+	ScaleRESTClient = func(kubernetes.Interface) restclient.Interface {
+		return discovery.NewDiscoveryClientForConfigOrDie(&restclient.Config{Host: server.URL}).RESTClient()
+	}
+	defer func() { ScaleRESTClient = discoveryRESTClient }()
+
+	target := Target{Namespace: fakeNS, Name: fakeName, APIVersion: "apps/v1", Kind: "StatefulSet"}
+	expectedReplicas := 3
+	if err := UpdateTargetReplicasCount(context.Background(), target, expectedReplicas); err != nil {
+		t.Fatal("error updating replicas of fake statefulset", err)
+	}
+
+	replicas, err := GetTargetReplicasCount(context.Background(), target)
+	if err != nil {
+		t.Fatal("error getting replicas of fake statefulset", err)
+	}
+	if replicas != expectedReplicas {
+		t.Errorf("expected %d, got %d", expectedReplicas, replicas)
+	}
+	if scale["kind"] != "Scale" {
+		t.Errorf("expected kind Scale, got %v", scale["kind"])
+	}
+
+	requests := len(fakeK8sClient.(*fake.Clientset).Actions())
+	preferred := Target{Namespace: fakeNS, Name: fakeName, Kind: "StatefulSet"}
+	if replicas, err := GetTargetReplicasCount(context.Background(), preferred); err != nil || replicas != expectedReplicas {
+		t.Errorf("expected %d replicas with the preferred version, got %d (%v)", expectedReplicas, replicas, err)
+	}
+	if n := len(fakeK8sClient.(*fake.Clientset).Actions()) - requests; n != 0 {
+		t.Errorf("expected discovery to be cached, got %d requests", n)
+	}
+
+	if err := UpdateTargetReplicasCount(context.Background(), target, expectedReplicas); err != nil {
+		t.Fatal("error updating replicas of fake statefulset", err)
+	}
+	if patches != 1 {
+		t.Errorf("expected 1 patch, got %d", patches)
+	}
+
+	target.Kind = "CronJob"
+	if err := UpdateTargetReplicasCount(context.Background(), target, expectedReplicas); err == nil {
+		t.Error("expected error scaling kind without scale subresource")
+	}
+}
+
+func testWatchConfigMap(t *testing.T) {
+	fakeNS := "fakeNS"
+	fakeCM := &v1.ConfigMap{Data: map[string]string{"entry": "{}"}}
+	fakeCM.Name = "config"
+	configMaps := fakeK8sClient.CoreV1().ConfigMaps(fakeNS)
+	if _, err := configMaps.Create(context.Background(), fakeCM, metav1.CreateOptions{}); err != nil {
 		t.Fatal("error creating fake config map", err)
 	}
 
-	if _, err := WatchConfigMap(fakeNS); err != nil {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watcher, err := WatchConfigMap(ctx, fakeNS, fakeCM.Name)
+	if err != nil {
 		t.Fatal("error getting watcher to config map", err)
 	}
+	expectNotification := func(expected bool, msg string) {
+		select {
+		case <-watcher:
+			if !expected {
+				t.Error(msg)
+			}
+		case <-time.After(200 * time.Millisecond):
+			if expected {
+				t.Error(msg)
+			}
+		}
+	}
+	expectNotification(true, "expected notification of the existing config map")
+
+	fakeCM.Labels = map[string]string{"team": "fake"}
+	if _, err := configMaps.Update(context.Background(), fakeCM, metav1.UpdateOptions{}); err != nil {
+		t.Fatal("error updating fake config map", err)
+	}
+	expectNotification(false, "expected no notification without data changes")
+
+	fakeCM.Data["entry"] = `{"active": true}`
+	if _, err := configMaps.Update(context.Background(), fakeCM, metav1.UpdateOptions{}); err != nil {
+		t.Fatal("error updating fake config map", err)
+	}
+	expectNotification(true, "expected notification of data changes")
+
+	for _, action := range fakeK8sClient.(*fake.Clientset).Actions() {
+		if list, ok := action.(k8stesting.ListAction); ok && action.GetResource().Resource == "configmaps" {
+			if selector := list.GetListRestrictions().Fields.String(); selector != "metadata.name=config" {
+				t.Errorf("expected field selector metadata.name=config, got %q", selector)
+			}
+		}
+	}
 }
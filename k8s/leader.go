@@ -0,0 +1,113 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	// LeaderLabel is set on the pod holding the lease, so services of the
+	// leader (like the external metrics API) can select only it.
+	LeaderLabel = "mitose.luizalabs.com/leader"
+
+	leaseName     = "mitose"
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// RunAsLeader blocks competing for the mitose lease of namespace and calls
+// run once it is acquired. The context of run is canceled when the lease is
+// lost, then RunAsLeader returns an error so the process can restart and
+// compete again.
+func RunAsLeader(ctx context.Context, namespace string, run func(ctx context.Context)) error {
+	kc, err := ClientBuilder("")
+	if err != nil {
+		return err
+	}
+	identity, err := leaderIdentity()
+	if err != nil {
+		return err
+	}
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Name: leaseName, Namespace: namespace},
+		Client:     kc.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   leaseDuration,
+		RenewDeadline:   renewDeadline,
+		RetryPeriod:     retryPeriod,
+		ReleaseOnCancel: true,
+		Name:            leaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				log.Printf("%s acquired lease %s/%s\n", identity, namespace, leaseName)
+				if err := setLeaderLabel(ctx, namespace, true); err != nil {
+					log.Println("error labeling leader pod:", err)
+				}
+				run(ctx)
+				stopInformers()
+			},
+			OnStoppedLeading: func() {
+				log.Printf("%s stopped leading %s/%s\n", identity, namespace, leaseName)
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					log.Printf("%s is the leader of %s/%s\n", leader, namespace, leaseName)
+				}
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	// like after acquiring the lease, a labeling error doesn't stop the election
+	if err := setLeaderLabel(ctx, namespace, false); err != nil {
+		log.Println("error unlabeling pod:", err)
+	}
+	elector.Run(ctx)
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("%s lost lease %s/%s", identity, namespace, leaseName)
+}
+
+// leaderIdentity is $POD_NAME, or the hostname (the pod name by default)
+func leaderIdentity() (string, error) {
+	if name := os.Getenv("POD_NAME"); name != "" {
+		return name, nil
+	}
+	return os.Hostname()
+}
+
+// setLeaderLabel sets or removes LeaderLabel on $POD_NAME. It is removed
+// before competing for the lease because labels survive container restarts.
+func setLeaderLabel(ctx context.Context, namespace string, leader bool) error {
+	name := os.Getenv("POD_NAME")
+	if name == "" {
+		return nil
+	}
+	kc, err := ClientBuilder("")
+	if err != nil {
+		return err
+	}
+	value := "null"
+	if leader {
+		value = `"true"`
+	}
+	patch := []byte(fmt.Sprintf(`{"metadata":{"labels":{%q:%s}}}`, LeaderLabel, value))
+	_, err = kc.CoreV1().Pods(namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
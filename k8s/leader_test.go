@@ -0,0 +1,71 @@
+package k8s
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRunAsLeader(t *testing.T) {
+	pod := &corev1.Pod{}
+	pod.Name = "mitose-abc"
+	pod.Namespace = "fakeNS"
+	pod.Labels = map[string]string{"run": "mitose", LeaderLabel: "true"}
+	fakeK8sClient = fake.NewSimpleClientset(pod)
+	ClientBuilder = fakeBuilder
+	defer func() { ClientBuilder = concretBuilder }()
+	os.Setenv("POD_NAME", pod.Name)
+	defer os.Unsetenv("POD_NAME")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var leaderLabel string
+	err := RunAsLeader(ctx, "fakeNS", func(ctx context.Context) {
+		p, err := fakeK8sClient.CoreV1().Pods("fakeNS").Get(ctx, pod.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Error("error getting pod", err)
+		} else {
+			leaderLabel = p.Labels[LeaderLabel]
+		}
+		cancel()
+	})
+	if err != context.Canceled {
+		t.Errorf("expected context canceled, got %v", err)
+	}
+	if leaderLabel != "true" {
+		t.Errorf("expected leader label on pod, got %q", leaderLabel)
+	}
+
+	lease, err := fakeK8sClient.CoordinationV1().Leases("fakeNS").Get(context.Background(), leaseName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal("error getting lease", err)
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != "" {
+		t.Errorf("expected lease released, got holder %v", lease.Spec.HolderIdentity)
+	}
+}
+
+func TestRunAsLeaderWithoutLabel(t *testing.T) {
+	// the pod can't be patched, like without RBAC for it
+	fakeK8sClient = fake.NewSimpleClientset()
+	ClientBuilder = fakeBuilder
+	defer func() { ClientBuilder = concretBuilder }()
+	os.Setenv("POD_NAME", "mitose-missing")
+	defer os.Unsetenv("POD_NAME")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	led := false
+	err := RunAsLeader(ctx, "fakeNS", func(ctx context.Context) {
+		led = true
+		cancel()
+	})
+	if err != context.Canceled {
+		t.Errorf("expected context canceled, got %v", err)
+	}
+	if !led {
+		t.Error("expected to lead without labeling the pod")
+	}
+}
@@ -0,0 +1,66 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// PodDeletionCostAnnotation ranks the pods of a ReplicaSet on scale down,
+// the pods with lower cost are deleted first.
+const PodDeletionCostAnnotation = "controller.kubernetes.io/pod-deletion-cost"
+
+// ListDeploymentPods returns the running pods selected by the deployment t.
+func ListDeploymentPods(ctx context.Context, t Target) ([]corev1.Pod, error) {
+	kc, err := ClientBuilder(t.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	deployYaml, err := getDeployment(ctx, kc, t.Namespace, t.Name, true)
+	if err != nil {
+		return nil, err
+	}
+	selector, err := metav1.LabelSelectorAsSelector(deployYaml.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	podList, err := kc.CoreV1().Pods(t.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	pods := make([]corev1.Pod, 0, len(podList.Items))
+	for _, pod := range podList.Items {
+		if pod.Status.Phase == corev1.PodRunning && pod.DeletionTimestamp == nil {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
+
+// SetPodDeletionCost annotates pod of t with cost, nothing is written when it
+// is already set.
+func SetPodDeletionCost(ctx context.Context, t Target, pod corev1.Pod, cost int) error {
+	value := strconv.Itoa(cost)
+	if pod.Annotations[PodDeletionCostAnnotation] == value {
+		return nil
+	}
+	kc, err := ClientBuilder(t.Cluster)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{PodDeletionCostAnnotation: value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = kc.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
@@ -0,0 +1,179 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/scale"
+	"k8s.io/client-go/util/retry"
+)
+
+// Target is the object scaled by a controller, an empty Kind means a Deployment
+// and an empty Cluster the cluster mitose runs on.
+// Jobs and CronJobs are templates of the jobs launched by ScaleJobs, any other
+// kind is scaled through its scale subresource.
+type Target struct {
+	Cluster    string
+	Namespace  string
+	Name       string
+	APIVersion string
+	Kind       string
+}
+
+var ScaleRESTClient func(kubernetes.Interface) restclient.Interface = discoveryRESTClient
+
+func discoveryRESTClient(kc kubernetes.Interface) restclient.Interface {
+	return kc.Discovery().RESTClient()
+}
+
+func (t Target) String() string {
+	kind := "deployment"
+	if t.Kind != "" {
+		kind = strings.ToLower(t.Kind)
+	}
+	if t.Cluster != "" {
+		return fmt.Sprintf("%s %s (namespace %s, cluster %s)", kind, t.Name, t.Namespace, t.Cluster)
+	}
+	return fmt.Sprintf("%s %s (namespace %s)", kind, t.Name, t.Namespace)
+}
+
+// GetTargetReplicasCount returns the replicas of t, or its unfinished jobs
+// when t is a Job or CronJob.
+func GetTargetReplicasCount(ctx context.Context, t Target) (int, error) {
+	if t.Kind == "" {
+		return GetReplicasCount(ctx, t)
+	}
+	if IsJobKind(t.Kind) {
+		return GetActiveJobsCount(ctx, t)
+	}
+	sc, resource, err := scalableResource(t)
+	if err != nil {
+		return -1, err
+	}
+	s, err := sc.scales.Scales(t.Namespace).Get(ctx, resource.GroupResource(), t.Name, metav1.GetOptions{})
+	if err != nil {
+		return -1, err
+	}
+	return int(s.Spec.Replicas), nil
+}
+
+func UpdateTargetReplicasCount(ctx context.Context, t Target, desiredReplicas int) error {
+	if t.Kind == "" {
+		return UpdateReplicasCount(ctx, t, desiredReplicas)
+	}
+	sc, resource, err := scalableResource(t)
+	if err != nil {
+		return err
+	}
+	scales := sc.scales.Scales(t.Namespace)
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		s, err := scales.Get(ctx, resource.GroupResource(), t.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if int(s.Spec.Replicas) == desiredReplicas {
+			return nil
+		}
+		patch, err := replicasPatch(s.ResourceVersion, desiredReplicas)
+		if err != nil {
+			return err
+		}
+		_, err = scales.Patch(ctx, resource, t.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+		return err
+	})
+}
+
+// GetTargetAnnotations returns the annotations of t itself, not of its scale subresource.
+func GetTargetAnnotations(ctx context.Context, t Target) (map[string]string, error) {
+	if t.Kind == "" {
+		return GetDeploymentAnnotations(ctx, t)
+	}
+	if IsJobKind(t.Kind) {
+		return getJobTemplateAnnotations(ctx, t)
+	}
+	_, resource, err := scalableResource(t)
+	if err != nil {
+		return nil, err
+	}
+	dc, err := DynamicClientBuilder(t.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	object, err := dc.Resource(resource).Namespace(t.Namespace).Get(ctx, t.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return object.GetAnnotations(), nil
+}
+
+// scaleClient scales any kind with a scale subresource, resolving kinds
+// through a discovery cached in memory.
+type scaleClient struct {
+	scales    scale.ScalesGetter
+	mapper    *restmapper.DeferredDiscoveryRESTMapper
+	discovery discovery.CachedDiscoveryInterface
+}
+
+// scalableResource maps the kind of t to its resource, using the preferred
+// version of its group when t has no APIVersion. The discovery is refreshed
+// once when the kind isn't found, so new CRDs are noticed.
+func scalableResource(t Target) (*scaleClient, schema.GroupVersionResource, error) {
+	kc, err := ClientBuilder(t.Cluster)
+	if err != nil {
+		return nil, schema.GroupVersionResource{}, err
+	}
+	sc := getScaleClient(kc)
+
+	kind := schema.GroupKind{Kind: t.Kind}
+	var versions []string
+	if t.APIVersion != "" {
+		gv, err := schema.ParseGroupVersion(t.APIVersion)
+		if err != nil {
+			return nil, schema.GroupVersionResource{}, err
+		}
+		kind.Group = gv.Group
+		versions = []string{gv.Version}
+	} else if kind.Group, err = kindGroup(sc, t.Kind); err != nil {
+		return nil, schema.GroupVersionResource{}, err
+	}
+
+	mapping, err := sc.mapper.RESTMapping(kind, versions...)
+	if meta.IsNoMatchError(err) {
+		sc.mapper.Reset()
+		mapping, err = sc.mapper.RESTMapping(kind, versions...)
+	}
+	if err != nil {
+		return nil, schema.GroupVersionResource{}, err
+	}
+	return sc, mapping.Resource, nil
+}
+
+// kindGroup finds the group of kind among the preferred versions.
+func kindGroup(sc *scaleClient, kind string) (string, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		resourceLists, err := sc.discovery.ServerPreferredNamespacedResources()
+		if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+			return "", err
+		}
+		for _, resourceList := range resourceLists {
+			for _, r := range resourceList.APIResources {
+				if r.Kind == kind {
+					gv, err := schema.ParseGroupVersion(resourceList.GroupVersion)
+					return gv.Group, err
+				}
+			}
+		}
+		sc.mapper.Reset()
+	}
+	return "", fmt.Errorf("kind %s not found", kind)
+}
@@ -0,0 +1,162 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+type secretKey struct {
+	namespace string
+	name      string
+}
+
+var (
+	secretsMu     = new(sync.Mutex)
+	secretCaches  = make(map[secretKey]*secretCache)
+	secretChanges = make(chan struct{}, 1)
+)
+
+// secretCache is the informer of a secret, synced is closed once its store
+// can be read or err is set.
+type secretCache struct {
+	informer cache.SharedIndexInformer
+	synced   chan struct{}
+	err      error
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func (c *secretCache) close() {
+	c.stopOnce.Do(func() { close(c.stop) })
+}
+
+// GetSecretValue returns the value of key on the secret and the secret
+// resourceVersion. Each secret is read from its own field selected informer,
+// started on first use, so only the referenced secrets are watched.
+func GetSecretValue(namespace, name, key string) (string, string, error) {
+	informer, err := secretInformer(namespace, name)
+	if err != nil {
+		return "", "", err
+	}
+	obj, found, err := informer.GetStore().GetByKey(namespace + "/" + name)
+	if err != nil {
+		return "", "", err
+	}
+	if !found {
+		return "", "", fmt.Errorf("secret %s/%s not found", namespace, name)
+	}
+	secret := obj.(*corev1.Secret)
+	value, found := secret.Data[key]
+	if !found {
+		return "", "", fmt.Errorf("key %s not found on secret %s/%s", key, namespace, name)
+	}
+	return string(value), secret.ResourceVersion, nil
+}
+
+// SecretChanges notifies every change on the data of the secrets read by
+// GetSecretValue.
+func SecretChanges() <-chan struct{} {
+	return secretChanges
+}
+
+// secretInformer waits for the informer of the secret without holding
+// secretsMu, so a secret slow to sync doesn't block the others. A failed sync
+// is retried by the next read.
+func secretInformer(namespace, name string) (cache.SharedIndexInformer, error) {
+	key := secretKey{namespace: namespace, name: name}
+	secretsMu.Lock()
+	c, found := secretCaches[key]
+	if !found {
+		kc, err := ClientBuilder("")
+		if err != nil {
+			secretsMu.Unlock()
+			return nil, err
+		}
+		c = startSecretCache(kc, namespace, name)
+		secretCaches[key] = c
+	}
+	secretsMu.Unlock()
+
+	<-c.synced
+	if c.err != nil {
+		secretsMu.Lock()
+		if secretCaches[key] == c {
+			delete(secretCaches, key)
+		}
+		secretsMu.Unlock()
+		return nil, c.err
+	}
+	return c.informer, nil
+}
+
+func startSecretCache(kc kubernetes.Interface, namespace, name string) *secretCache {
+	factory := informers.NewSharedInformerFactoryWithOptions(
+		kc,
+		informerResyncPeriod,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}),
+	)
+	informer := factory.Core().V1().Secrets().Informer()
+	informer.SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+		log.Printf("error watching secret %s/%s: %s\n", namespace, name, err)
+	})
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(interface{}) { notify(secretChanges) },
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if reflect.DeepEqual(oldObj.(*corev1.Secret).Data, newObj.(*corev1.Secret).Data) {
+				return
+			}
+			notify(secretChanges)
+		},
+		DeleteFunc: func(interface{}) { notify(secretChanges) },
+	})
+	c := &secretCache{
+		informer: informer,
+		synced:   make(chan struct{}),
+		stop:     make(chan struct{}),
+	}
+	factory.Start(c.stop)
+
+	go func() {
+		defer close(c.synced)
+		ctx, cancel := context.WithTimeout(context.Background(), informerSyncTimeout)
+		defer cancel()
+		go func() {
+			select {
+			case <-c.stop:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+			c.err = fmt.Errorf("timeout syncing secret %s/%s", namespace, name)
+			c.close()
+		}
+	}()
+	return c
+}
+
+// StopUnusedSecretInformers stops the informers of the secrets for which used
+// is false, reading them again starts new ones.
+func StopUnusedSecretInformers(used func(namespace, name string) bool) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for key, c := range secretCaches {
+		if !used(key.namespace, key.name) {
+			c.close()
+			delete(secretCaches, key)
+		}
+	}
+}
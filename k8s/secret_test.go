@@ -0,0 +1,68 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetSecretValue(t *testing.T) {
+	secret := &corev1.Secret{Data: map[string][]byte{"key": []byte("fakeKey")}}
+	secret.Name = "aws"
+	secret.Namespace = "fakeNS"
+	secret.ResourceVersion = "1"
+	fakeK8sClient = fake.NewSimpleClientset(secret)
+	ClientBuilder = fakeBuilder
+	defer func() { ClientBuilder = concretBuilder }()
+
+	value, version, err := GetSecretValue("fakeNS", "aws", "key")
+	if err != nil {
+		t.Fatal("error getting secret value", err)
+	}
+	if value != "fakeKey" || version != "1" {
+		t.Errorf("expected fakeKey on version 1, got %s on version %s", value, version)
+	}
+	if _, _, err := GetSecretValue("fakeNS", "aws", "unknown"); err == nil {
+		t.Error("expected error getting unknown key")
+	}
+	if _, _, err := GetSecretValue("fakeNS", "unknown", "key"); err == nil {
+		t.Error("expected error getting unknown secret")
+	}
+
+	secret.Data["key"] = []byte("newKey")
+	secret.ResourceVersion = "2"
+	if _, err := fakeK8sClient.CoreV1().Secrets("fakeNS").Update(context.Background(), secret, metav1.UpdateOptions{}); err != nil {
+		t.Fatal("error updating secret", err)
+	}
+	select {
+	case <-SecretChanges():
+	case <-time.After(time.Second):
+		t.Fatal("expected notification of secret change")
+	}
+	deadline := time.Now().Add(time.Second)
+	for value != "newKey" && time.Now().Before(deadline) {
+		value, _, _ = GetSecretValue("fakeNS", "aws", "key")
+		time.Sleep(time.Millisecond)
+	}
+	if value != "newKey" {
+		t.Errorf("expected newKey, got %s", value)
+	}
+	c := secretCaches[secretKey{namespace: "fakeNS", name: "aws"}]
+	StopUnusedSecretInformers(func(namespace, name string) bool { return name != "aws" })
+	if _, found := secretCaches[secretKey{namespace: "fakeNS", name: "aws"}]; found {
+		t.Error("expected the informer of an unused secret to be removed")
+	}
+	select {
+	case <-c.stop:
+	default:
+		t.Error("expected the informer of an unused secret to be stopped")
+	}
+	if value, _, err := GetSecretValue("fakeNS", "aws", "key"); err != nil || value != "newKey" {
+		t.Errorf("expected newKey from a new informer, got %q (%v)", value, err)
+	}
+	stopInformers()
+}
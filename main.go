@@ -3,88 +3,205 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
-	"golang.org/x/sync/errgroup"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 
 	"github.com/luizalabs/mitose/config"
 	"github.com/luizalabs/mitose/controller"
+	"github.com/luizalabs/mitose/external"
 	"github.com/luizalabs/mitose/gauge"
 	"github.com/luizalabs/mitose/k8s"
+	"github.com/luizalabs/mitose/webhook"
+)
+
+const (
+	configMapName     = "config"
+	configRetryPeriod = 30 * time.Second
 )
 
 func main() {
+	printSchema := flag.Bool("schema", false, "print the JSON Schema of the controller configs and exit")
+	validate := flag.Bool("validate", false, "validate the controller config files given as arguments and exit")
+	flag.Parse()
+	if *printSchema {
+		schema, err := controller.Schema()
+		if err != nil {
+			printErrorAndExit("generating schema", err)
+		}
+		fmt.Println(string(schema))
+		return
+	}
+	if *validate {
+		if !validateFiles(flag.Args()) {
+			os.Exit(1)
+		}
+		return
+	}
+
 	currentNS, err := k8s.GetCurrentNamespace()
 	if err != nil {
 		printErrorAndExit("getting current namespace name", err)
 	}
-	configWatcher := getConfigWatcher(currentNS)
 
 	go gauge.Run()
+	if os.Getenv("EXTERNAL_METRICS_PORT") != "" {
+		go func() { printErrorAndExit("serving external metrics", external.Run()) }()
+	}
+	if os.Getenv("WEBHOOK_PORT") != "" {
+		go func() { printErrorAndExit("serving admission webhook", webhook.Run(currentNS, configMapName)) }()
+	}
+	// canceling releases the lease, so another replica takes over right away
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	err = k8s.RunAsLeader(ctx, currentNS, func(ctx context.Context) {
+		runControllers(ctx, currentNS)
+	})
+	if ctx.Err() != nil {
+		log.Println("mitose stopped")
+		return
+	}
+	printErrorAndExit("running as leader", err)
+}
+
+// runControllers runs the controllers of the config map, of the
+// MitoseAutoscalers and of the annotated deployments until ctx is done, on
+// every change only the controllers whose config (or referenced secrets)
+// changed are restarted.
+func runControllers(leaderCtx context.Context, currentNS string) {
+	configWatcher, err := k8s.WatchConfigMap(leaderCtx, currentNS, configMapName)
+	if err != nil {
+		printErrorAndExit("watching configmap", err)
+	}
+	// both wait for their informers until synced or the leadership is lost
+	autoscalerWatcher, err := k8s.WatchAutoscalers(leaderCtx)
+	if leaderCtx.Err() != nil {
+		return
+	}
+	if err != nil {
+		printErrorAndExit("watching mitoseautoscalers", err)
+	}
+	var deploymentWatcher <-chan struct{}
+	if os.Getenv("ANNOTATION_DISCOVERY") == "true" {
+		deploymentWatcher, err = k8s.WatchAnnotatedDeployments(leaderCtx)
+		if leaderCtx.Err() != nil {
+			return
+		}
+		if err != nil {
+			printErrorAndExit("watching annotated deployments", err)
+		}
+	}
+	reconciler := controller.NewReconciler(leaderCtx)
+	defer reconciler.Stop()
+	var retry <-chan time.Time
 	for {
-		ctx, cancel := context.WithCancel(context.Background())
-		errChan := make(chan error)
-		go func() { errChan <- run(ctx, currentNS) }()
+		entries, err := controllerEntries(currentNS)
+		if err != nil {
+			log.Println("error reading controllers config, keeping the running controllers:", err)
+			retry = time.After(configRetryPeriod)
+		} else {
+			retry = nil
+			reconciler.Reconcile(entries)
+		}
 
 		select {
-		case err, ok := <-configWatcher:
-			if err != nil {
-				printErrorAndExit("watching configmap", err)
-			}
-			if !ok {
-				configWatcher = getConfigWatcher(currentNS)
-			}
-			log.Println("rebuilding controllers")
-			cancel()
-		case err := <-errChan:
-			log.Println("error received on errChan:", err)
-			if err != nil && err != context.Canceled {
-				printErrorAndExit("running controllers", err)
-			}
+		case <-retry:
+		case <-configWatcher:
+		case <-k8s.SecretChanges():
+		// nil (blocking forever) when the MitoseAutoscaler CRD isn't installed
+		case <-autoscalerWatcher:
+		// nil when the annotation discovery is disabled
+		case <-deploymentWatcher:
+		case <-leaderCtx.Done():
+			return
 		}
 	}
 }
 
-func getConfigWatcher(namespace string) <-chan error {
-	configWatcher, err := k8s.WatchConfigMap(namespace)
-	if err != nil {
-		printErrorAndExit("watching configmaps", err)
+// controllerEntries keys the entries of the config map by their name and
+// the MitoseAutoscalers and annotated deployments by namespace/name. An
+// annotated deployment already scaled by another entry is skipped.
+func controllerEntries(currentNS string) (map[string]controller.Entry, error) {
+	configData, err := k8s.GetConfigMapData(currentNS, configMapName)
+	if apierrors.IsNotFound(err) {
+		configData = nil
+	} else if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]controller.Entry)
+	for k, v := range configData {
+		entries["configmap/"+k] = controller.Entry{Config: v}
 	}
-	<-configWatcher // expected at least one config map
-	return configWatcher
-}
 
-func run(ctx context.Context, currentNS string) error {
-	configData, err := k8s.GetConfigMapData(currentNS, "config")
+	autoscalers, err := k8s.ListAutoscalers()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	for i := range autoscalers {
+		a := autoscalers[i]
+		v, err := a.Config()
+		if err != nil {
+			return nil, err
+		}
+		key := fmt.Sprintf("%s/%s/%s", strings.ToLower(k8s.AutoscalerKind), a.Namespace, a.Name)
+		entries[key] = controller.Entry{Config: v, Autoscaler: &a, Namespace: a.Namespace}
 	}
 
-	controllers := make([]*controller.Controller, 0)
-	for _, v := range configData {
+	annotated, err := k8s.ListAnnotatedDeployments()
+	if err != nil {
+		return nil, err
+	}
+	if len(annotated) == 0 {
+		return entries, nil
+	}
+	targets := make(map[string]string, len(entries))
+	for key, entry := range entries {
 		conf := new(config.Config)
-		if err := json.Unmarshal([]byte(v), conf); err != nil {
-			return err
+		if json.Unmarshal([]byte(entry.Config), conf) == nil && conf.Cluster == "" {
+			targets[conf.Namespace+"/"+conf.Deployment] = key
 		}
-		if !conf.Active {
+	}
+	for _, d := range annotated {
+		if key, found := targets[d.Namespace+"/"+d.Name]; found {
+			log.Printf("skipping annotations of deployment %s/%s, already scaled by %s\n", d.Namespace, d.Name, key)
 			continue
 		}
-		c, err := controller.Factory(conf.Type, v)
-		if err != nil {
-			return err
-		}
-		controllers = append(controllers, c)
+		key := fmt.Sprintf("deployment/%s/%s", d.Namespace, d.Name)
+		entries[key] = controller.Entry{Config: controller.AnnotationsConfig(d), Namespace: d.Namespace}
 	}
+	return entries, nil
+}
 
-	g, ctx := errgroup.WithContext(ctx)
-	for _, currentController := range controllers {
-		c := currentController
-		g.Go(func() error { return c.Run(ctx) })
+// validateFiles prints every error of the controller configs on files,
+// returning whether all of them are valid.
+func validateFiles(files []string) bool {
+	valid := true
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err == nil {
+			err = controller.Validate(string(data))
+		}
+		if err == nil {
+			continue
+		}
+		valid = false
+		if verr, ok := err.(*controller.ValidationError); ok {
+			for _, e := range verr.Errors {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", file, e)
+			}
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
 	}
-
-	return g.Wait()
+	return valid
 }
 
 func printErrorAndExit(phase string, err error) {
@@ -9,11 +9,25 @@ import (
 
 type GCPMetrics struct {
 	googleApplicationCredentials string
+	credentialsJSON              []byte
 	projectID                    string
 	region                       string
 }
 
-func (m *GCPMetrics) newClient() (*monitoring.MetricClient, error) {
-	ctx := context.Background()
-	return monitoring.NewMetricClient(ctx, option.WithCredentialsFile(m.googleApplicationCredentials))
+func (m *GCPMetrics) newClient(ctx context.Context) (*monitoring.MetricClient, error) {
+	return monitoring.NewMetricClient(ctx, m.clientOptions()...)
+}
+
+// clientOptions authenticates with the credentials JSON or file when one of
+// them is set, otherwise with the Application Default Credentials (workload
+// identity, metadata server or $GOOGLE_APPLICATION_CREDENTIALS).
+func (m *GCPMetrics) clientOptions() []option.ClientOption {
+	switch {
+	case m.credentialsJSON != nil:
+		return []option.ClientOption{option.WithCredentialsJSON(m.credentialsJSON)}
+	case m.googleApplicationCredentials != "":
+		return []option.ClientOption{option.WithCredentialsFile(m.googleApplicationCredentials)}
+	default:
+		return nil
+	}
 }
@@ -0,0 +1,32 @@
+package pubsub
+
+import (
+	"fmt"
+	"testing"
+
+	"google.golang.org/api/option"
+)
+
+func TestClientOptions(t *testing.T) {
+	var testCases = []struct {
+		metrics  *GCPMetrics
+		expected []option.ClientOption
+	}{
+		{&GCPMetrics{}, nil},
+		{&GCPMetrics{googleApplicationCredentials: "/credentials.json"}, []option.ClientOption{option.WithCredentialsFile("/credentials.json")}},
+		{&GCPMetrics{credentialsJSON: []byte("{}"), googleApplicationCredentials: "/credentials.json"}, []option.ClientOption{option.WithCredentialsJSON([]byte("{}"))}},
+	}
+
+	for _, tc := range testCases {
+		options := tc.metrics.clientOptions()
+		if len(options) != len(tc.expected) {
+			t.Errorf("expected %v, got %v", tc.expected, options)
+			continue
+		}
+		for i := range options {
+			if fmt.Sprintf("%#v", options[i]) != fmt.Sprintf("%#v", tc.expected[i]) {
+				t.Errorf("expected %#v, got %#v", tc.expected[i], options[i])
+			}
+		}
+	}
+}
@@ -20,12 +20,12 @@ type PubSubClient struct {
 	*GCPMetrics
 }
 
-func (m *GCPMetrics) GetNumOfUndeliveredMessages(subscriptionID string) (int, error) {
-	c, err := m.newClient()
+func (m *GCPMetrics) GetNumOfUndeliveredMessages(ctx context.Context, subscriptionID string) (int, error) {
+	c, err := m.newClient(ctx)
 	if err != nil {
 		return -1, err
 	}
-	ctx := context.Background()
+	defer c.Close()
 	startTime := time.Now().UTC().Add(time.Minute * -5).Unix()
 	endTime := time.Now().UTC().Unix()
 
@@ -67,3 +67,15 @@ func NewPubSubClient(googleApplicationCredentials, projectID, region string) *Pu
 		},
 	}
 }
+
+// NewPubSubClientWithCredentialsJSON authenticates with the content of a
+// credentials file instead of its location.
+func NewPubSubClientWithCredentialsJSON(credentialsJSON []byte, projectID, region string) *PubSubClient {
+	return &PubSubClient{
+		GCPMetrics: &GCPMetrics{
+			credentialsJSON: credentialsJSON,
+			region:          region,
+			projectID:       projectID,
+		},
+	}
+}
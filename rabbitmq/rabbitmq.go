@@ -1,30 +1,46 @@
 package rabbitmq
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 )
 
+// requestTimeout bounds each request, besides the deadline of its context.
+const requestTimeout = 30 * time.Second
+
+var httpClient = &http.Client{Timeout: requestTimeout}
+
 type RabbitMQClient struct {
 }
 
 type RabbitMQResponse struct {
-	Messages float64 `json:"messages"`
+	Messages               float64 `json:"messages"`
+	MessagesReady          float64 `json:"messages_ready"`
+	MessagesUnacknowledged float64 `json:"messages_unacknowledged"`
 }
 
-func (r *RabbitMQClient) GetNumOfMessages(url, credentials string) (int, error) {
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
-
+func (r *RabbitMQClient) GetNumOfMessages(ctx context.Context, url, credentials string) (int, error) {
+	rabbitMQResponse, err := r.GetQueueStats(ctx, url, credentials)
 	if err != nil {
 		return -1, err
 	}
+	return int(rabbitMQResponse.Messages), nil
+}
+
+func (r *RabbitMQClient) GetQueueStats(ctx context.Context, url, credentials string) (*RabbitMQResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+
+	if err != nil {
+		return nil, err
+	}
 	req.Header.Add("Authorization", fmt.Sprintf("Basic %s", credentials))
 
-	res, err := client.Do(req)
+	res, err := httpClient.Do(req)
 	if err != nil {
-		return -1, err
+		return nil, err
 	}
 	defer res.Body.Close()
 
@@ -32,8 +48,8 @@ func (r *RabbitMQClient) GetNumOfMessages(url, credentials string) (int, error)
 
 	err = json.NewDecoder(res.Body).Decode(&rabbitMQResponse)
 	if err != nil {
-		return -1, err
+		return nil, err
 	}
 
-	return int(rabbitMQResponse.Messages), nil
+	return rabbitMQResponse, nil
 }